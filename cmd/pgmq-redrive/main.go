@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	_ "github.com/lib/pq"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+)
+
+// errUsage is returned when the flags are invalid, the usage is already printed.
+var errUsage = errors.New("invalid flags")
+
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "postgres connection string, default env DATABASE_URL")
+	schema := flag.String("schema", "pgmq", "schema where pgmq is installed")
+	from := flag.String("from", "", "queue to read the messages, usually the dlq")
+	to := flag.String("to", "", "queue to send the messages")
+	maxCount := flag.Int("max", 0, "max of messages to redrive, 0 means all")
+	olderThan := flag.Duration("older-than", 0, "only messages enqueued before this duration, ex: 1h")
+	newerThan := flag.Duration("newer-than", 0, "only messages enqueued in this duration, ex: 24h")
+	match := flag.String("match", "", "only messages whose body has the field with the value, ex: type=subscription")
+	rate := flag.Int("rate", 0, "max of messages by second, 0 means no limit")
+	batchSize := flag.Int("batch-size", consumer.DEFAULT_REDRIVE_BATCH_SIZE, "messages read by query")
+	visibilityTime := flag.Int("vt", consumer.DEFAULT_REDRIVE_VISIBILITY_TIME, "visibility time in seconds of the messages read")
+	keepEnvelope := flag.Bool("keep-envelope", false, "send the dlq envelope instead of the original message")
+	dryRun := flag.Bool("dry-run", false, "only count the messages that would be redriven")
+	flag.Parse()
+
+	if *dsn == "" || *from == "" || *to == "" {
+		flag.Usage()
+		return errUsage
+	}
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	defer db.Close()
+
+	options := consumer.RedriveOptions{
+		MaxCount:       *maxCount,
+		OlderThan:      *olderThan,
+		NewerThan:      *newerThan,
+		RatePerSecond:  *rate,
+		DryRun:         *dryRun,
+		KeepEnvelope:   *keepEnvelope,
+		BatchSize:      *batchSize,
+		VisibilityTime: *visibilityTime,
+	}
+
+	if *match != "" {
+		field, value, ok := strings.Cut(*match, "=")
+		if !ok {
+			fmt.Fprintln(os.Stderr, "match must be in the format field=value")
+			return errUsage
+		}
+
+		options.Predicate = func(msg consumer.Message) bool {
+			body := msg.Message
+			if envelope, ok := consumer.ParseDlqEnvelope(msg); ok {
+				body = envelope.Body()
+			}
+			return fmt.Sprint(body[field]) == value
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := consumer.Redrive(ctx, queuedriver.NewPostgresQueueDriver(db, *schema), *from, *to, options)
+	if *dryRun {
+		fmt.Printf("%d messages would be redriven from %s to %s, %d skipped\n", result.Redriven, *from, *to, result.Skipped)
+	} else {
+		fmt.Printf("%d messages redriven from %s to %s, %d skipped, %d failed\n", result.Redriven, *from, *to, result.Skipped, result.Failed)
+	}
+
+	if err != nil {
+		return fmt.Errorf("redrive stopped with error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package consumer
+
+import "time"
+
+const DEFAULT_ACK_FLUSH_WINDOW_MS = 10
+
+type ackRequest struct {
+	msgID          int64
+	completionMode string
+	done           chan error
+}
+
+func (c *Consumer) ackFlushWindow() time.Duration {
+	if c.options.AckFlushWindowMs > 0 {
+		return time.Duration(c.options.AckFlushWindowMs) * time.Millisecond
+	}
+	return DEFAULT_ACK_FLUSH_WINDOW_MS * time.Millisecond
+}
+
+func (c *Consumer) supportsAckCoalescing() bool {
+	if c.options.ConsumerType == "pop" || c.batchHandler != nil || c.options.Transactional {
+		return false
+	}
+
+	_, canDeleteBatch := c.queueDriver.(BatchDeleter)
+	_, canArchiveBatch := c.queueDriver.(BatchArchiver)
+	_, canCompleteBatch := c.queueDriver.(BatchCompleter)
+	return canDeleteBatch || canArchiveBatch || canCompleteBatch
+}
+
+// startAcker coalesces the deletes and archives requested by the workers in
+// the flush window into batch calls. Each worker waits at most one ack, so
+// the batch is flushed earlier when every worker is waiting.
+func (c *Consumer) startAcker() {
+	defer close(c.ackerStopped)
+
+	for {
+		var first ackRequest
+		select {
+		case first = <-c.acks:
+		case <-c.stopAcker:
+			return
+		}
+
+		pending := []ackRequest{first}
+		timer := time.NewTimer(c.ackFlushWindow())
+	collect:
+		for len(pending) < c.options.PoolSize {
+			select {
+			case request := <-c.acks:
+				pending = append(pending, request)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		c.flushAcks(pending)
+	}
+}
+
+func (c *Consumer) flushAcks(pending []ackRequest) {
+	if batchCompleter, ok := c.queueDriver.(BatchCompleter); ok {
+		var deleteIDs, archiveIDs []int64
+		for _, request := range pending {
+			if request.completionMode == COMPLETION_MODE_ARCHIVE {
+				archiveIDs = append(archiveIDs, request.msgID)
+			} else {
+				deleteIDs = append(deleteIDs, request.msgID)
+			}
+		}
+
+		err := batchCompleter.CompleteBatch(c.options.QueueName, deleteIDs, archiveIDs)
+		for _, request := range pending {
+			request.done <- err
+		}
+		return
+	}
+
+	messageIDs := map[string][]int64{}
+	for _, request := range pending {
+		messageIDs[request.completionMode] = append(messageIDs[request.completionMode], request.msgID)
+	}
+
+	errs := map[string]error{}
+	for completionMode, ids := range messageIDs {
+		errs[completionMode] = c.completeMessages(ids, completionMode)
+	}
+
+	for _, request := range pending {
+		request.done <- errs[request.completionMode]
+	}
+}
+
+func (c *Consumer) ack(msgID int64, completionMode string) error {
+	request := ackRequest{msgID: msgID, completionMode: completionMode, done: make(chan error, 1)}
+	select {
+	case c.acks <- request:
+		return <-request.done
+	case <-c.ackerStopped:
+		return c.completeMessage(msgID, completionMode)
+	}
+}
@@ -0,0 +1,269 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// BatchHandler receives all the messages accumulated in a batch. Messages
+// not listed in BatchResult.Failed are considered processed with success.
+type BatchHandler func(ctx context.Context, messages []Message) (BatchResult, error)
+
+type BatchResult struct {
+	Failed map[int64]error
+}
+
+// BatchDeleter, BatchSender and BatchArchiver are implemented by queue
+// drivers able to handle many messages in one round trip.
+type BatchDeleter interface {
+	DeleteBatch(queueName string, messageIDs []int64) error
+}
+
+type BatchSender interface {
+	SendBatch(queueName string, messages []map[string]interface{}, signal context.Context) error
+}
+
+type BatchArchiver interface {
+	ArchiveBatch(queueName string, messageIDs []int64) error
+}
+
+// BatchCompleter is implemented by queue drivers able to delete and archive
+// messages in one round trip.
+type BatchCompleter interface {
+	CompleteBatch(queueName string, deleteIDs []int64, archiveIDs []int64) error
+}
+
+func NewBatchConsumer(
+	handler BatchHandler,
+	options ConsumerOptions,
+	queueDriver QueueDriver,
+) (*Consumer, error) {
+	if options.Transactional {
+		return nil, errors.New("Transactional is not supported by the batch consumer")
+	}
+	if len(options.Middlewares) > 0 {
+		return nil, errors.New("Middlewares is not supported by the batch consumer")
+	}
+	if options.Codec != nil {
+		return nil, errors.New("Codec is not supported by the batch consumer")
+	}
+
+	consumer, err := NewConsumerWithHandler(nil, options, queueDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer.batchHandler = handler
+	return consumer, nil
+}
+
+func (c *Consumer) batchMaxSize() int {
+	if c.options.BatchMaxSize > 0 {
+		return c.options.BatchMaxSize
+	}
+	if c.options.PoolSize > 0 {
+		return c.options.PoolSize
+	}
+	return 1
+}
+
+func (c *Consumer) startBatchWorker() {
+	defer c.workers.Done()
+
+	c.logger.Debug("batch worker started")
+	defer c.logger.Debug("batch worker stopped")
+
+	maxSize := c.batchMaxSize()
+	maxWait := time.Duration(c.options.BatchMaxWaitMs) * time.Millisecond
+
+	var batch []Message
+	var startedAt time.Time
+	var timer *time.Timer
+	var timerC <-chan time.Time
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timerC = nil
+		}
+		c.processBatch(batch, startedAt)
+		batch = nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-c.channelMessage:
+			if !ok {
+				if c.isStopping() {
+					for _, notStarted := range batch {
+						c.notifyEventListener(EVENT_LISTENER_NOT_STARTED, notStarted, nil)
+					}
+				} else if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+
+			if c.isStopping() {
+				c.notifyEventListener(EVENT_LISTENER_NOT_STARTED, msg, nil)
+				continue
+			}
+
+			if len(batch) == 0 {
+				startedAt = time.Now()
+				if maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					timerC = timer.C
+				}
+			}
+			batch = append(batch, msg)
+			c.metrics.Backlog(c.options.QueueName, len(c.channelMessage))
+
+			if len(batch) >= maxSize || (maxWait <= 0 && len(c.channelMessage) == 0) {
+				flush()
+			}
+		case <-timerC:
+			timerC = nil
+			flush()
+		}
+	}
+}
+
+func (c *Consumer) processBatch(batch []Message, startedAt time.Time) {
+	logger := c.logger.With("batch_size", len(batch))
+
+	ctx, cancel := context.WithDeadline(
+		c.workersCtx,
+		startedAt.Add(time.Duration(c.options.VisibilityTime)*time.Second),
+	)
+	defer cancel()
+
+	// each message has its own span, the handler receives the batch context
+	messageCtx := make(map[int64]context.Context, len(batch))
+	for _, msg := range batch {
+		spanCtx, span := c.startSpan(ctx, msg)
+		messageCtx[msg.MsgID] = spanCtx
+		defer span.End()
+	}
+
+	timerToCancel := time.AfterFunc(time.Until(startedAt.Add(time.Duration(c.options.VisibilityTime)*time.Second)), func() {
+		cancel()
+		logger.Warn("batch aborted, visibility time expired")
+		for _, msg := range batch {
+			c.metrics.MessageAborted(c.options.QueueName)
+			c.lastErrors.record(msg.MsgID, ctx.Err())
+			spanFromContext(messageCtx[msg.MsgID]).AddEvent(EVENT_LISTENER_ABORT_ERROR)
+			spanFromContext(messageCtx[msg.MsgID]).RecordError(ctx.Err())
+			c.notifyEventListener(EVENT_LISTENER_ABORT_ERROR, msg, ctx.Err())
+		}
+	})
+	defer timerToCancel.Stop()
+
+	messages := make([]Message, 0, len(batch))
+	for _, msg := range batch {
+		if c.shouldSendToDlq(msg) {
+			c.sendToDlq(messageCtx[msg.MsgID], c.messageLogger(logger, msg), msg)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	if len(messages) == 0 {
+		return
+	}
+
+	c.metrics.WorkersInFlight(c.options.QueueName, 1)
+	handlerStartedAt := time.Now()
+	result, err := c.batchHandler(ctx, messages)
+	duration := time.Since(handlerStartedAt)
+	c.metrics.WorkersInFlight(c.options.QueueName, -1)
+	if err != nil {
+		logger.Warn("error processing batch", "duration", duration, "error", err)
+		for _, msg := range messages {
+			c.metrics.MessageFailed(c.options.QueueName, duration)
+			c.lastErrors.record(msg.MsgID, err)
+			spanFromContext(messageCtx[msg.MsgID]).RecordError(err)
+			c.notifyEventListener(EVENT_LISTENER_ERROR, msg, err)
+			c.scheduleRetry(messageCtx[msg.MsgID], c.messageLogger(logger, msg), msg)
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		logger.Warn("batch processed after visibility time expired", "duration", duration)
+		return
+	}
+
+	succeeded := make([]Message, 0, len(messages))
+	var duplicates []Message
+	for _, msg := range messages {
+		err := result.Failed[msg.MsgID]
+		if errors.Is(err, ErrDuplicate) {
+			duplicates = append(duplicates, msg)
+			continue
+		}
+		if err != nil {
+			c.messageLogger(logger, msg).Warn("error processing message", "error", err)
+			c.metrics.MessageFailed(c.options.QueueName, duration)
+			c.lastErrors.record(msg.MsgID, err)
+			spanFromContext(messageCtx[msg.MsgID]).RecordError(err)
+			c.notifyEventListener(EVENT_LISTENER_ERROR, msg, err)
+			c.scheduleRetry(messageCtx[msg.MsgID], c.messageLogger(logger, msg), msg)
+			continue
+		}
+		succeeded = append(succeeded, msg)
+	}
+
+	if err := c.removeMessages(append(succeeded, duplicates...)); err != nil {
+		return
+	}
+	logger.Debug("batch processed", "duration", duration, "succeeded", len(succeeded), "duplicates", len(duplicates))
+	for _, msg := range duplicates {
+		spanFromContext(messageCtx[msg.MsgID]).AddEvent(EVENT_LISTENER_DUPLICATE)
+		c.lastErrors.forget(msg.MsgID)
+		c.notifyEventListener(EVENT_LISTENER_DUPLICATE, msg, nil)
+	}
+	for _, msg := range succeeded {
+		c.recordProcessed(msg, duration)
+		c.lastErrors.forget(msg.MsgID)
+		c.notifyEventListener(EVENT_LISTENER_FINISH, msg, nil)
+	}
+}
+
+func (c *Consumer) removeMessages(messages []Message) error {
+	if c.options.ConsumerType == "pop" || len(messages) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		messageIDs = append(messageIDs, msg.MsgID)
+	}
+
+	err := c.completeMessages(messageIDs, c.options.CompletionMode)
+	if err != nil {
+		for _, msg := range messages {
+			c.notifyDriverError(completionOperation(c.options.CompletionMode), c.options.QueueName, msg, err)
+		}
+	}
+	return err
+}
+
+func (c *Consumer) completeMessages(messageIDs []int64, completionMode string) error {
+	if completionMode == COMPLETION_MODE_ARCHIVE {
+		if batchArchiver, ok := c.queueDriver.(BatchArchiver); ok {
+			return batchArchiver.ArchiveBatch(c.options.QueueName, messageIDs)
+		}
+	} else if batchDeleter, ok := c.queueDriver.(BatchDeleter); ok {
+		return batchDeleter.DeleteBatch(c.options.QueueName, messageIDs)
+	}
+
+	var errs []error
+	for _, messageID := range messageIDs {
+		if err := c.completeMessage(messageID, completionMode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Codec decodes the message body to the payload of a typed consumer.
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte, value interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec) Decode(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// StrictJSONCodec rejects bodies with fields unknown to the payload type.
+type StrictJSONCodec struct{}
+
+func (StrictJSONCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (StrictJSONCodec) Decode(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+// DecodeError is returned when the message body cannot be decoded. Messages
+// failing with it are sent to the dlq immediately instead of being retried.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "error decoding message: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -3,21 +3,71 @@ package consumer
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var ErrConsumerAlreadyStarted = errors.New("consumer already started")
+
+// ErrDuplicate is returned by the handler, usually by the dedup middleware,
+// when the message was already processed. The message is removed from the
+// queue without calling the error listeners.
+var ErrDuplicate = errors.New("message already processed")
+
+// ErrOperationNotSupported is returned by the queue drivers when the database
+// doesn't have the function of the operation, like set_vt in the Supabase
+// schema pgmq_public.
+var ErrOperationNotSupported = errors.New("operation not supported by the queue driver")
+
 type Consumer struct {
-	handler        handler
+	handler        Handler
+	batchHandler   BatchHandler
 	options        ConsumerOptions
 	channelMessage chan Message
 	queueDriver    QueueDriver
+
+	mutex         sync.Mutex
+	started       bool
+	stopping      chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
+	workers       sync.WaitGroup
+	workersCtx    context.Context
+	cancelWorkers context.CancelFunc
+	state         atomic.Value
+	acks          chan ackRequest
+	stopAcker     chan struct{}
+	ackerStopped  chan struct{}
+	lastErrors    *errorTracker
+	logger        *slog.Logger
+	metrics       MetricsRecorder
+	tracer        Tracer
+}
+
+// AdaptHandler converts a handler receiving only the message body to a
+// Handler. Bodies that are not json objects reach the handler as nil, like
+// before the typed consumer, use NewTypedConsumer to decode them.
+func AdaptHandler(handler func(msg map[string]interface{}) error) Handler {
+	return func(ctx context.Context, msg Message) error {
+		return handler(msg.Message)
+	}
 }
 
 func NewConsumer(
 	handler handler,
 	options ConsumerOptions,
 	queueDriver QueueDriver,
+) (*Consumer, error) {
+	return NewConsumerWithHandler(AdaptHandler(handler), options, queueDriver)
+}
+
+func NewConsumerWithHandler(
+	handler Handler,
+	options ConsumerOptions,
+	queueDriver QueueDriver,
 ) (*Consumer, error) {
 	channelMessage := make(chan Message, options.PoolSize)
 
@@ -29,11 +79,56 @@ func NewConsumer(
 		return nil, errors.New("TotalRetriesBeforeSendToDlq must be set if QueueNameDlq is set")
 	}
 
+	if !isValidCompletionMode(options.CompletionMode) || !isValidCompletionMode(options.DlqCompletionMode) {
+		return nil, errors.New("CompletionMode and DlqCompletionMode must be 'delete' or 'archive'")
+	}
+
+	if err := validateTransactional(options, queueDriver); err != nil {
+		return nil, err
+	}
+
+	if err := validateLongPolling(options, queueDriver); err != nil {
+		return nil, err
+	}
+
+	if err := validateEnsureQueues(options, queueDriver); err != nil {
+		return nil, err
+	}
+
+	if handler != nil {
+		handler = chainMiddlewares(handler, options.Middlewares)
+	}
+
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	var metrics MetricsRecorder = noopMetricsRecorder{}
+	if options.Metrics != nil {
+		metrics = options.Metrics
+	}
+
+	var tracer Tracer = noopTracer{}
+	if options.Tracer != nil {
+		tracer = options.Tracer
+	}
+
 	return &Consumer{
 		handler:        handler,
 		options:        options,
 		channelMessage: channelMessage,
 		queueDriver:    queueDriver,
+		stopping:       make(chan struct{}),
+		done:           make(chan struct{}),
+		workersCtx:     workersCtx,
+		cancelWorkers:  cancelWorkers,
+		lastErrors:     newErrorTracker(),
+		logger:         logger.With("queue", options.QueueName),
+		metrics:        metrics,
+		tracer:         tracer,
 	}, nil
 }
 
@@ -43,23 +138,98 @@ func (c *Consumer) notifyEventListener(event string, msg Message, err error) {
 	}
 }
 
-func (c *Consumer) removeMessage(msg Message) {
-	if c.options.ConsumerType == "pop" {
+func (c *Consumer) isStopping() bool {
+	select {
+	case <-c.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Consumer) stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopping)
+	})
+}
+
+func (c *Consumer) wait(duration time.Duration) {
+	if duration <= 0 {
 		return
 	}
 
-	c.queueDriver.Delete(c.options.QueueName, msg.MsgID)
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-c.stopping:
+	}
+}
+
+func (c *Consumer) notifyDriverError(operation string, queueName string, msg Message, err error) {
+	c.logger.Error("queue driver error",
+		"operation", operation,
+		"queue", queueName,
+		"msg_id", msg.MsgID,
+		"error", err,
+	)
+	c.notifyEventListener(EVENT_LISTENER_DRIVER_ERROR, msg, &DriverError{
+		Operation: operation,
+		QueueName: queueName,
+		Err:       err,
+	})
+}
+
+func (c *Consumer) removeMessage(msg Message, completionMode string) error {
+	if c.options.ConsumerType == "pop" {
+		return nil
+	}
+
+	var err error
+	if c.acks != nil {
+		err = c.ack(msg.MsgID, completionMode)
+	} else {
+		err = c.completeMessage(msg.MsgID, completionMode)
+	}
+
+	if err != nil {
+		c.notifyDriverError(completionOperation(completionMode), c.options.QueueName, msg, err)
+	}
+	return err
+}
+
+func completionOperation(completionMode string) string {
+	if completionMode == COMPLETION_MODE_ARCHIVE {
+		return DRIVER_OPERATION_ARCHIVE
+	}
+	return DRIVER_OPERATION_DELETE
 }
 
-func (c *Consumer) getMessages() []Message {
+func (c *Consumer) completeMessage(msgID int64, completionMode string) error {
+	return completeMessage(c.queueDriver, c.options.QueueName, msgID, completionMode)
+}
+
+func completeMessage(queueDriver QueueDriver, queueName string, msgID int64, completionMode string) error {
+	if completionMode == COMPLETION_MODE_ARCHIVE {
+		return queueDriver.Archive(queueName, msgID)
+	}
+	return queueDriver.Delete(queueName, msgID)
+}
+
+func (c *Consumer) getMessages(ctx context.Context) ([]Message, error) {
 	if c.options.ConsumerType == "pop" {
 		result, err := c.queueDriver.Pop(c.options.QueueName)
 		if err != nil {
-			fmt.Println("error getting messages", err)
-			return nil
+			c.notifyDriverError(DRIVER_OPERATION_POP, c.options.QueueName, Message{}, err)
+			return nil, err
 		}
 
-		return result
+		return result, nil
+	}
+
+	if c.options.MaxPollSeconds > 0 {
+		return c.readWithPoll(ctx)
 	}
 
 	result, err := c.queueDriver.Get(
@@ -68,101 +238,404 @@ func (c *Consumer) getMessages() []Message {
 		c.options.PoolSize,
 	)
 	if err != nil {
-		fmt.Println("error getting messages", err)
-		return nil
+		c.notifyDriverError(DRIVER_OPERATION_GET, c.options.QueueName, Message{}, err)
+		return nil, err
 	}
 
-	return result
+	return result, nil
 }
 
-func (c *Consumer) polling() {
-	messages := c.getMessages()
-	if len(messages) == 0 && c.options.EnabledPolling {
-		time.Sleep(time.Duration(c.options.TimeMsWaitBeforeNextPolling) * time.Millisecond)
-		c.polling()
-	} else {
-		for _, msg := range messages {
-			c.channelMessage <- msg
+func (c *Consumer) dispatch(messages []Message) {
+	for i, msg := range messages {
+		select {
+		case c.channelMessage <- msg:
+		case <-c.stopping:
+			for _, notStarted := range messages[i:] {
+				c.messageLogger(c.logger, notStarted).Info("message not started because consumer is shutting down")
+				c.notifyEventListener(EVENT_LISTENER_NOT_STARTED, notStarted, nil)
+			}
+			return
 		}
+	}
+}
 
-		if c.options.EnabledPolling {
-			c.polling()
-		} else {
-			time.Sleep(time.Duration(c.options.VisibilityTime) * time.Second)
+func (c *Consumer) setState(state PollingState) {
+	c.state.Store(state)
+	if c.options.StateListener != nil {
+		c.options.StateListener(state)
+	}
+}
+
+// State returns the current state of the polling loop.
+func (c *Consumer) State() PollingState {
+	state, ok := c.state.Load().(PollingState)
+	if !ok {
+		return POLLING_STATE_IDLE
+	}
+	return state
+}
+
+func (c *Consumer) polling(notifications <-chan struct{}) {
+	defer c.setState(POLLING_STATE_STOPPED)
+
+	ctx, cancel := c.stoppingContext()
+	defer cancel()
+
+	for !c.isStopping() {
+		c.setState(POLLING_STATE_FETCHING)
+		messages, err := c.getMessages(ctx)
+		if len(messages) > 0 {
+			c.metrics.MessagesFetched(c.options.QueueName, len(messages))
+		}
+
+		if len(messages) == 0 && c.options.EnabledPolling {
+			// the long polling already waited on the server
+			if c.options.MaxPollSeconds > 0 && err == nil {
+				continue
+			}
+			if notifications != nil {
+				c.setState(POLLING_STATE_LISTENING)
+				c.waitNotification(notifications)
+				continue
+			}
+			c.setState(POLLING_STATE_BACKING_OFF)
+			c.wait(time.Duration(c.options.TimeMsWaitBeforeNextPolling) * time.Millisecond)
+			continue
+		}
+
+		c.setState(POLLING_STATE_DISPATCHING)
+		c.logger.Debug("messages fetched", "count", len(messages))
+		c.dispatch(messages)
+		c.metrics.Backlog(c.options.QueueName, len(c.channelMessage))
+
+		if !c.options.EnabledPolling {
+			return
 		}
 	}
 }
 
-func (c *Consumer) processMessage(ctx context.Context, msg Message) error {
+func (c *Consumer) messageLogger(logger *slog.Logger, msg Message) *slog.Logger {
+	return logger.With("msg_id", msg.MsgID, "read_ct", msg.ReadCT, "attempt", msg.ReadCT)
+}
+
+// setDefaultLogger passes the logger of the consumer to the queue drivers and
+// notifiers without a logger, they can be shared with other consumers.
+func setDefaultLogger(target interface{}, logger *slog.Logger) {
+	if logged, ok := target.(interface{ SetDefaultLogger(logger *slog.Logger) }); ok {
+		logged.SetDefaultLogger(logger)
+	}
+}
+
+func (c *Consumer) processMessage(ctx context.Context, logger *slog.Logger, msg Message) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		err := c.handler(msg.Message)
+		var tx Transaction
+		if c.options.Transactional {
+			var err error
+			ctx, tx, err = c.beginTransaction(ctx, msg)
+			if err != nil {
+				return nil
+			}
+			// no effect after commit
+			defer tx.Rollback()
+		}
+
+		startedAt := time.Now()
+		err := c.handler(ctx, msg)
+		duration := time.Since(startedAt)
+		if errors.Is(err, ErrDuplicate) {
+			return c.skipDuplicate(ctx, logger, tx, msg)
+		}
 		if err != nil {
+			logger.Warn("error processing message", "duration", duration, "error", err)
+			c.metrics.MessageFailed(c.options.QueueName, duration)
+			c.lastErrors.record(msg.MsgID, err)
+			spanFromContext(ctx).RecordError(err)
 			c.notifyEventListener(EVENT_LISTENER_ERROR, msg, err)
+
+			if isInvalidMessage(err) {
+				if c.options.QueueNameDlq != "" {
+					return c.sendToDlq(ctx, logger, msg)
+				}
+				return nil
+			}
+
+			c.scheduleRetry(ctx, logger, msg)
 			return nil
 		}
 
 		if err := ctx.Err(); err != nil {
+			logger.Warn("message processed after visibility time expired", "duration", duration)
 			return nil
 		}
 
-		c.removeMessage(msg)
+		if tx != nil {
+			if err := c.commitMessage(tx, msg); err != nil {
+				return nil
+			}
+		} else if err := c.removeMessage(msg, c.options.CompletionMode); err != nil {
+			return nil
+		}
+		logger.Debug("message processed", "duration", duration)
+		c.recordProcessed(msg, duration)
+		c.lastErrors.forget(msg.MsgID)
 		c.notifyEventListener(EVENT_LISTENER_FINISH, msg, nil)
 		return nil
 	}
 }
 
-func (c *Consumer) sendToDlq(ctx context.Context, msg Message) error {
+// skipDuplicate discards the writes of the transaction, the duplicate can
+// be detected after the handler ran.
+func (c *Consumer) skipDuplicate(ctx context.Context, logger *slog.Logger, tx Transaction, msg Message) error {
+	if tx != nil {
+		tx.Rollback()
+	}
+	if err := c.removeMessage(msg, c.options.CompletionMode); err != nil {
+		return nil
+	}
+
+	logger.Info("duplicate message removed")
+	spanFromContext(ctx).AddEvent(EVENT_LISTENER_DUPLICATE)
+	c.lastErrors.forget(msg.MsgID)
+	c.notifyEventListener(EVENT_LISTENER_DUPLICATE, msg, nil)
+	return nil
+}
+
+func (c *Consumer) scheduleRetry(ctx context.Context, logger *slog.Logger, msg Message) {
+	if c.options.RetryPolicy == nil || c.options.ConsumerType == "pop" {
+		return
+	}
+
+	// After the visibility time the message can be read by another worker, so
+	// changing it would hide the message from that worker.
+	if ctx.Err() != nil {
+		logger.Warn("visibility time expired before schedule retry")
+		return
+	}
+
+	delay := c.options.RetryPolicy(msg.ReadCT)
+	if delay < 0 {
+		delay = 0
+	}
+
+	err := c.queueDriver.SetVisibilityTime(
+		c.options.QueueName,
+		msg.MsgID,
+		int(math.Ceil(delay.Seconds())),
+	)
+	if errors.Is(err, ErrOperationNotSupported) {
+		logger.Debug("retry policy not supported by the queue driver, message visible again after the visibility time")
+		return
+	}
+	if err != nil {
+		c.notifyDriverError(DRIVER_OPERATION_SET_VT, c.options.QueueName, msg, err)
+		return
+	}
+
+	logger.Info("message scheduled to retry", "delay", delay)
+	spanFromContext(ctx).AddEvent(EVENT_LISTENER_RETRY)
+	c.notifyEventListener(EVENT_LISTENER_RETRY, msg, nil)
+}
+
+func (c *Consumer) sendToDlq(ctx context.Context, logger *slog.Logger, msg Message) error {
 	select {
 	case <-ctx.Done():
-		fmt.Println("timeout processing message")
+		logger.Warn("visibility time expired before send message to dlq")
 		return ctx.Err()
 	default:
-		c.queueDriver.Send(c.options.QueueNameDlq, msg.Message, context.Background())
+		err := sendWithHeaders(c.queueDriver, c.options.QueueNameDlq, c.dlqBody(msg), msg.Headers, context.Background())
+		if err != nil {
+			c.notifyDriverError(DRIVER_OPERATION_SEND, c.options.QueueNameDlq, msg, err)
+			return nil
+		}
+
 		if err := ctx.Err(); err != nil {
-			fmt.Println("context canceled")
+			logger.Warn("message sent to dlq after visibility time expired", "queue_dlq", c.options.QueueNameDlq)
 			return nil
 		}
 
-		c.removeMessage(msg)
+		if err := c.removeMessage(msg, c.options.DlqCompletionMode); err != nil {
+			return nil
+		}
+		logger.Warn("message sent to dlq", "queue_dlq", c.options.QueueNameDlq)
+		c.metrics.MessageDeadLettered(c.options.QueueName)
+		spanFromContext(ctx).AddEvent(EVENT_LISTENER_SEND_TO_DLQ)
+		c.lastErrors.forget(msg.MsgID)
 		c.notifyEventListener(EVENT_LISTENER_SEND_TO_DLQ, msg, nil)
 		return nil
 	}
 
 }
 
+func (c *Consumer) shouldSendToDlq(msg Message) bool {
+	return c.options.TotalRetriesBeforeSendToDlq > 0 &&
+		c.options.QueueNameDlq != "" &&
+		msg.ReadCT > c.options.TotalRetriesBeforeSendToDlq
+}
+
 func (c *Consumer) startWorker(i int) {
-	fmt.Println("Worker", i, "started")
+	defer c.workers.Done()
+
+	workerLogger := c.logger.With("worker_id", i)
+	workerLogger.Debug("worker started")
+	defer workerLogger.Debug("worker stopped")
+
 	for msg := range c.channelMessage {
+		c.metrics.Backlog(c.options.QueueName, len(c.channelMessage))
+		logger := c.messageLogger(workerLogger, msg)
+		if c.isStopping() {
+			logger.Info("message not started because consumer is shutting down")
+			c.notifyEventListener(EVENT_LISTENER_NOT_STARTED, msg, nil)
+			continue
+		}
+
 		ctx, cancel := context.WithTimeout(
-			context.Background(),
+			c.workersCtx,
 			time.Duration(c.options.VisibilityTime)*time.Second,
 		)
+		ctx, span := c.startSpan(ctx, msg)
 
 		timerToCancel := time.AfterFunc(time.Duration(c.options.VisibilityTime)*time.Second, func() {
 			cancel()
+			logger.Warn("message aborted, visibility time expired")
+			c.metrics.MessageAborted(c.options.QueueName)
+			c.lastErrors.record(msg.MsgID, ctx.Err())
+			span.AddEvent(EVENT_LISTENER_ABORT_ERROR)
+			span.RecordError(ctx.Err())
 			c.notifyEventListener(EVENT_LISTENER_ABORT_ERROR, msg, ctx.Err())
 		})
 
-		if c.options.TotalRetriesBeforeSendToDlq > 0 &&
-			c.options.QueueNameDlq != "" &&
-			msg.ReadCT > c.options.TotalRetriesBeforeSendToDlq {
-			if err := c.sendToDlq(ctx, msg); err == nil {
+		c.metrics.WorkersInFlight(c.options.QueueName, 1)
+		if c.shouldSendToDlq(msg) {
+			if err := c.sendToDlq(ctx, logger, msg); err == nil {
 				timerToCancel.Stop()
 			}
 		} else {
-			if err := c.processMessage(ctx, msg); err == nil {
+			if err := c.processMessage(ctx, logger, msg); err == nil {
 				timerToCancel.Stop()
 			}
 		}
+		c.metrics.WorkersInFlight(c.options.QueueName, -1)
+		span.End()
+		cancel()
 	}
 }
 
-func (c *Consumer) Start() {
-	for i := 0; i < c.options.PoolSize; i++ {
-		go c.startWorker(i)
+func (c *Consumer) waitWorkers(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		c.workers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		c.cancelWorkers()
+		return ctx.Err()
+	}
+}
+
+// Run starts the workers and polls the queue until ctx is cancelled or
+// Shutdown is called. Messages fetched but not handed to a worker yet are
+// reported through EVENT_LISTENER_NOT_STARTED and become visible again
+// once their visibility time expires.
+func (c *Consumer) Run(ctx context.Context) error {
+	c.mutex.Lock()
+	if c.started {
+		c.mutex.Unlock()
+		return ErrConsumerAlreadyStarted
+	}
+	c.started = true
+	c.mutex.Unlock()
+
+	if c.options.Logger != nil {
+		setDefaultLogger(c.queueDriver, c.options.Logger)
+		setDefaultLogger(c.options.Notifier, c.options.Logger)
+	}
+
+	c.logger.Info("consumer started", "consumer_type", c.options.ConsumerType, "pool_size", c.options.PoolSize)
+	defer c.logger.Info("consumer stopped")
+	defer close(c.done)
+	defer c.cancelWorkers()
+
+	if err := ensureQueues(ctx, c.options, c.queueDriver); err != nil {
+		var driverErr *DriverError
+		if errors.As(err, &driverErr) {
+			c.notifyDriverError(driverErr.Operation, driverErr.QueueName, Message{}, driverErr.Err)
+		}
+		return err
+	}
+
+	stopWatcher := context.AfterFunc(ctx, c.stop)
+	defer stopWatcher()
+
+	if c.supportsAckCoalescing() {
+		c.acks = make(chan ackRequest)
+		c.stopAcker = make(chan struct{})
+		c.ackerStopped = make(chan struct{})
+		go c.startAcker()
+		defer close(c.stopAcker)
+	}
+
+	if c.batchHandler != nil {
+		c.workers.Add(1)
+		go c.startBatchWorker()
+	} else {
+		for i := 0; i < c.options.PoolSize; i++ {
+			c.workers.Add(1)
+			go c.startWorker(i)
+		}
+	}
+
+	notifications, stopListening := c.listen()
+	defer stopListening()
+
+	c.polling(notifications)
+	close(c.channelMessage)
+
+	// The handlers are cancelled after the visibility time, so a handler
+	// ignoring its ctx doesn't block Run forever. Shutdown cancels the wait
+	// earlier when its ctx expires.
+	waitCtx, cancel := context.WithTimeout(
+		c.workersCtx,
+		time.Duration(c.options.VisibilityTime)*time.Second,
+	)
+	defer cancel()
+	c.waitWorkers(waitCtx)
+	return nil
+}
+
+// Shutdown stops polling and waits for in-flight messages to finish. If ctx
+// expires first, in-flight messages are cancelled and ctx.Err() is returned.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.stop()
+
+	c.mutex.Lock()
+	started := c.started
+	c.mutex.Unlock()
+	if !started {
+		return nil
 	}
-	c.polling()
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		c.cancelWorkers()
+		return ctx.Err()
+	}
+}
+
+func (c *Consumer) Start() {
+	c.Run(context.Background())
+}
+
+func isValidCompletionMode(completionMode string) bool {
+	return completionMode == "" ||
+		completionMode == COMPLETION_MODE_DELETE ||
+		completionMode == COMPLETION_MODE_ARCHIVE
 }
@@ -0,0 +1,100 @@
+package dedup
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+// DEFAULT_CLAIM_TIMEOUT is the time a key stays claimed when the handler
+// context has no deadline.
+const DEFAULT_CLAIM_TIMEOUT = 5 * time.Minute
+
+// Store records the keys of the messages. Claim reserves the key atomically
+// until the time informed and returns false if the key is claimed or was
+// processed. Mark records the key as processed and Release frees the claim
+// when the handler fails.
+type Store interface {
+	Claim(ctx context.Context, key string, until time.Time) (bool, error)
+	Mark(ctx context.Context, key string) error
+	Release(ctx context.Context, key string) error
+}
+
+// KeyFunc returns the key identifying the message, for example an id of
+// the body when the producer can send the same message twice.
+type KeyFunc func(msg consumer.Message) (string, error)
+
+type DedupOptions struct {
+	// Key default is MessageIDKey of the queue. A custom key is shared by
+	// all the queues using the same store.
+	Key KeyFunc
+	// Logger receives the errors of Mark and Release, they don't fail the
+	// message already processed. Default no logs.
+	Logger *slog.Logger
+}
+
+// MessageIDKey returns "<queue>:<msg_id>", each pgmq queue numbers its
+// messages from 1, so the msg_id alone collides between queues.
+func MessageIDKey(queueName string) KeyFunc {
+	return func(msg consumer.Message) (string, error) {
+		return queueName + ":" + strconv.FormatInt(msg.MsgID, 10), nil
+	}
+}
+
+// Middleware claims the key of the message before calling the handler, so
+// two workers with the same key don't run the handler twice. The messages
+// whose key is claimed or processed return consumer.ErrDuplicate, the
+// consumer removes them from the queue and notifies EVENT_LISTENER_DUPLICATE.
+// The claim lasts until the deadline of the handler context, the visibility
+// time. queueName is the queue consumed.
+func Middleware(store Store, queueName string, options DedupOptions) consumer.Middleware {
+	key := options.Key
+	if key == nil {
+		key = MessageIDKey(queueName)
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	return func(next consumer.Handler) consumer.Handler {
+		return func(ctx context.Context, msg consumer.Message) error {
+			messageKey, err := key(msg)
+			if err != nil {
+				return err
+			}
+
+			until, ok := ctx.Deadline()
+			if !ok {
+				until = time.Now().Add(DEFAULT_CLAIM_TIMEOUT)
+			}
+
+			claimed, err := store.Claim(ctx, messageKey, until)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return consumer.ErrDuplicate
+			}
+
+			// The handler context is cancelled when the visibility time
+			// expires, the store still needs to record the result.
+			storeCtx := context.WithoutCancel(ctx)
+			if err := next(ctx, msg); err != nil {
+				if releaseErr := store.Release(storeCtx, messageKey); releaseErr != nil {
+					logger.Warn("dedup key not released", "key", messageKey, "msg_id", msg.MsgID, "error", releaseErr)
+				}
+				return err
+			}
+
+			if err := store.Mark(storeCtx, messageKey); err != nil {
+				logger.Warn("dedup key not marked as processed", "key", messageKey, "msg_id", msg.MsgID, "error", err)
+			}
+			return nil
+		}
+	}
+}
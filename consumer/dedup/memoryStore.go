@@ -0,0 +1,121 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const DEFAULT_MEMORY_STORE_CAPACITY = 10000
+
+type MemoryStoreOptions struct {
+	// Capacity is the max of keys kept, the least recently used are
+	// evicted first. Default 10000.
+	Capacity int
+	// TTL is the time a key is kept, 0 means no expiration.
+	TTL time.Duration
+	// Now default is time.Now, used in tests.
+	Now func() time.Time
+}
+
+// MemoryStore is a LRU store with expiration. It only deduplicates the
+// messages processed by the same process.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+	keys     map[string]*list.Element
+	order    *list.List
+}
+
+type memoryEntry struct {
+	key      string
+	markedAt time.Time
+	// claimedUntil is zero after the key is marked.
+	claimedUntil time.Time
+}
+
+func NewMemoryStore(options MemoryStoreOptions) *MemoryStore {
+	capacity := options.Capacity
+	if capacity <= 0 {
+		capacity = DEFAULT_MEMORY_STORE_CAPACITY
+	}
+
+	now := options.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MemoryStore{
+		capacity: capacity,
+		ttl:      options.TTL,
+		now:      now,
+		keys:     map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+func (m *MemoryStore) Claim(ctx context.Context, key string, until time.Time) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if element, ok := m.keys[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if !m.expired(entry) {
+			m.order.MoveToFront(element)
+			return false, nil
+		}
+		m.order.Remove(element)
+		delete(m.keys, key)
+	}
+
+	m.push(&memoryEntry{key: key, markedAt: m.now(), claimedUntil: until})
+	return true, nil
+}
+
+func (m *MemoryStore) Mark(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if element, ok := m.keys[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		entry.markedAt = m.now()
+		entry.claimedUntil = time.Time{}
+		m.order.MoveToFront(element)
+		return nil
+	}
+
+	m.push(&memoryEntry{key: key, markedAt: m.now()})
+	return nil
+}
+
+// Release removes the key only while it is claimed, a key marked as
+// processed is kept.
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if element, ok := m.keys[key]; ok && !element.Value.(*memoryEntry).claimedUntil.IsZero() {
+		m.order.Remove(element)
+		delete(m.keys, key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) push(entry *memoryEntry) {
+	m.keys[entry.key] = m.order.PushFront(entry)
+	for m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.keys, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+func (m *MemoryStore) expired(entry *memoryEntry) bool {
+	if !entry.claimedUntil.IsZero() {
+		return !m.now().Before(entry.claimedUntil)
+	}
+	return m.ttl > 0 && m.now().Sub(entry.markedAt) >= m.ttl
+}
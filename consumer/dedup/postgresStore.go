@@ -0,0 +1,105 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+)
+
+const DEFAULT_POSTGRES_STORE_TABLE = "pgmq_processed_messages"
+
+type PostgresStoreOptions struct {
+	// Table default is "pgmq_processed_messages", create it with EnsureTable.
+	Table string
+	// TTL is the time a key is kept, 0 means no expiration. The expired keys
+	// are deleted by Purge.
+	TTL time.Duration
+}
+
+// PostgresStore keeps the keys in a table, shared by all the consumers. When
+// the consumer runs with the option Transactional the key is marked in the
+// transaction of the message, so it is committed with the handler writes.
+type PostgresStore struct {
+	db    queuedriver.DBTX
+	table string
+	ttl   time.Duration
+}
+
+func NewPostgresStore(db queuedriver.DBTX, options PostgresStoreOptions) *PostgresStore {
+	table := options.Table
+	if table == "" {
+		table = DEFAULT_POSTGRES_STORE_TABLE
+	}
+	return &PostgresStore{db: db, table: table, ttl: options.TTL}
+}
+
+func (p *PostgresStore) EnsureTable(ctx context.Context) error {
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		key           TEXT PRIMARY KEY,
+		processed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		claimed_until TIMESTAMPTZ
+	);`, p.table))
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;`, p.table))
+	return err
+}
+
+// Claim inserts the key, or takes it when the claim or the ttl expired. A
+// concurrent claim of the same key in another transaction waits its commit.
+func (p *PostgresStore) Claim(ctx context.Context, key string, until time.Time) (bool, error) {
+	result, err := p.conn(ctx).ExecContext(ctx, fmt.Sprintf(`INSERT INTO %[1]s (key, processed_at, claimed_until)
+		VALUES ($1, now(), $2)
+		ON CONFLICT (key) DO UPDATE SET processed_at = now(), claimed_until = $2
+		WHERE (%[1]s.claimed_until IS NOT NULL AND %[1]s.claimed_until <= now())
+		OR (%[1]s.claimed_until IS NULL AND $3::float8 > 0 AND %[1]s.processed_at <= now() - make_interval(secs => $3::float8));`, p.table),
+		key, until, p.ttl.Seconds())
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return claimed > 0, nil
+}
+
+func (p *PostgresStore) Mark(ctx context.Context, key string) error {
+	_, err := p.conn(ctx).ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (key, processed_at)
+		VALUES ($1, now())
+		ON CONFLICT (key) DO UPDATE SET processed_at = now(), claimed_until = NULL;`, p.table), key)
+	return err
+}
+
+// Release deletes the claim. In the transaction of the message the rollback
+// already deletes it, so nothing is done.
+func (p *PostgresStore) Release(ctx context.Context, key string) error {
+	if queuedriver.TxFromContext(ctx) != nil {
+		return nil
+	}
+
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s
+		WHERE key = $1 AND claimed_until IS NOT NULL;`, p.table), key)
+	return err
+}
+
+// Purge deletes the keys expired and the claims not released, for example
+// of a consumer that crashed.
+func (p *PostgresStore) Purge(ctx context.Context) error {
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s
+		WHERE claimed_until <= now()
+		OR (claimed_until IS NULL AND $1::float8 > 0 AND processed_at <= now() - make_interval(secs => $1::float8));`, p.table), p.ttl.Seconds())
+	return err
+}
+
+func (p *PostgresStore) conn(ctx context.Context) queuedriver.DBTX {
+	if tx := queuedriver.TxFromContext(ctx); tx != nil {
+		return tx
+	}
+	return p.db
+}
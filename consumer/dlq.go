@@ -0,0 +1,127 @@
+package consumer
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const MAX_TRACKED_ERRORS = 10000
+
+// DlqEnvelope is the body sent to the dlq, keeping the metadata of the
+// original message and the last error returned by the handler.
+type DlqEnvelope struct {
+	Message        json.RawMessage `json:"message"`
+	OriginalMsgID  int64           `json:"original_msg_id"`
+	ReadCT         int64           `json:"read_ct"`
+	EnqueuedAt     string          `json:"enqueued_at"`
+	SourceQueue    string          `json:"source_queue"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeadLetteredAt string          `json:"dead_lettered_at"`
+}
+
+// ParseDlqEnvelope returns the envelope of a message read from the dlq, or
+// false if the message was sent with DlqRawBody.
+func ParseDlqEnvelope(msg Message) (DlqEnvelope, bool) {
+	var envelope DlqEnvelope
+	if msg.Message == nil {
+		return envelope, false
+	}
+
+	_, hasSourceQueue := msg.Message["source_queue"]
+	_, hasOriginalMsgID := msg.Message["original_msg_id"]
+	if !hasSourceQueue || !hasOriginalMsgID {
+		return envelope, false
+	}
+
+	data, err := messageBody(msg)
+	if err != nil {
+		return envelope, false
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return envelope, false
+	}
+	return envelope, true
+}
+
+// Body returns the original message, or nil if it is not a json object.
+func (e DlqEnvelope) Body() map[string]interface{} {
+	var body map[string]interface{}
+	json.Unmarshal(e.Message, &body)
+	return body
+}
+
+type errorTracker struct {
+	mutex  sync.Mutex
+	errors map[int64]string
+}
+
+func newErrorTracker() *errorTracker {
+	return &errorTracker{errors: map[int64]string{}}
+}
+
+func (e *errorTracker) record(msgID int64, err error) {
+	if err == nil {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.errors[msgID]; !ok && len(e.errors) >= MAX_TRACKED_ERRORS {
+		for trackedMsgID := range e.errors {
+			delete(e.errors, trackedMsgID)
+			break
+		}
+	}
+	e.errors[msgID] = err.Error()
+}
+
+func (e *errorTracker) last(msgID int64) string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.errors[msgID]
+}
+
+func (e *errorTracker) forget(msgID int64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.errors, msgID)
+}
+
+func rawBody(msg Message) map[string]interface{} {
+	if msg.Message == nil && len(msg.Raw) > 0 {
+		return map[string]interface{}{"message": msg.Raw}
+	}
+	return msg.Message
+}
+
+func (c *Consumer) dlqBody(msg Message) map[string]interface{} {
+	if c.options.DlqRawBody {
+		return rawBody(msg)
+	}
+
+	body, err := messageBody(msg)
+	if err != nil {
+		return rawBody(msg)
+	}
+
+	envelope, err := json.Marshal(DlqEnvelope{
+		Message:        body,
+		OriginalMsgID:  msg.MsgID,
+		ReadCT:         msg.ReadCT,
+		EnqueuedAt:     msg.EnqueuedAt,
+		SourceQueue:    c.options.QueueName,
+		LastError:      c.lastErrors.last(msg.MsgID),
+		DeadLetteredAt: time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return rawBody(msg)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(envelope, &result); err != nil {
+		return rawBody(msg)
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Common message headers. Any other key can be used, pgmq stores the
+// headers as a json object next to the body.
+const HEADER_CORRELATION_ID = "correlation-id"
+const HEADER_TENANT_ID = "tenant-id"
+const HEADER_CONTENT_TYPE = "content-type"
+const HEADER_SCHEMA_VERSION = "schema-version"
+
+// Header returns the header as string, or "" if it is not set.
+func (m Message) Header(key string) string {
+	value, ok := m.Headers[key]
+	if !ok || value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// RawSender is implemented by queue drivers able to send bodies that are not
+// json objects, like the producer does.
+type RawSender interface {
+	SendMessages(
+		queueName string,
+		messages []json.RawMessage,
+		headers []map[string]interface{},
+		delaySeconds int,
+		signal context.Context,
+	) ([]int64, error)
+}
+
+// sendWithHeaders keeps the headers when the driver supports them, so the
+// messages sent to the dlq or redriven carry the same headers.
+func sendWithHeaders(
+	queueDriver QueueDriver,
+	queueName string,
+	message map[string]interface{},
+	headers map[string]interface{},
+	signal context.Context,
+) error {
+	if headersSender, ok := queueDriver.(HeadersSender); ok && len(headers) > 0 {
+		return headersSender.SendWithHeaders(queueName, message, headers, signal)
+	}
+	return queueDriver.Send(queueName, message, signal)
+}
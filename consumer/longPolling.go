@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+)
+
+const DEFAULT_POLL_INTERVAL_MS = 100
+
+// LongPoller is implemented by queue drivers able to wait for messages on
+// the server, like pgmq.read_with_poll. The read must stop when ctx is
+// cancelled.
+type LongPoller interface {
+	ReadWithPoll(
+		ctx context.Context,
+		queueName string,
+		visibilityTime int,
+		totalMessages int,
+		maxPollSeconds int,
+		pollIntervalMs int,
+	) ([]Message, error)
+}
+
+func validateLongPolling(options ConsumerOptions, queueDriver QueueDriver) error {
+	if options.MaxPollSeconds <= 0 {
+		return nil
+	}
+
+	if options.ConsumerType != "read" {
+		return errors.New("MaxPollSeconds requires ConsumerType 'read'")
+	}
+
+	if _, ok := queueDriver.(LongPoller); !ok {
+		return errors.New("MaxPollSeconds requires a queue driver implementing LongPoller")
+	}
+	return nil
+}
+
+// stoppingContext returns a context cancelled when the consumer stops.
+func (c *Consumer) stoppingContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (c *Consumer) readWithPoll(ctx context.Context) ([]Message, error) {
+	pollIntervalMs := c.options.PollIntervalMs
+	if pollIntervalMs <= 0 {
+		pollIntervalMs = DEFAULT_POLL_INTERVAL_MS
+	}
+
+	result, err := c.queueDriver.(LongPoller).ReadWithPoll(
+		ctx,
+		c.options.QueueName,
+		c.options.VisibilityTime,
+		c.options.PoolSize,
+		c.options.MaxPollSeconds,
+		pollIntervalMs,
+	)
+	if err != nil {
+		// the read cancelled by the shutdown is not a driver error
+		if ctx.Err() == nil {
+			c.notifyDriverError(DRIVER_OPERATION_READ_WITH_POLL, c.options.QueueName, Message{}, err)
+		}
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package consumer
+
+import "time"
+
+// MetricsRecorder receives the measurements of the consumer. The package
+// consumer/metrics implements it using prometheus.
+type MetricsRecorder interface {
+	MessagesFetched(queueName string, total int)
+	MessageProcessed(queueName string, duration time.Duration)
+	MessageFailed(queueName string, duration time.Duration)
+	MessageAborted(queueName string)
+	MessageDeadLettered(queueName string)
+	MessageLatency(queueName string, latency time.Duration)
+	WorkersInFlight(queueName string, delta int)
+	Backlog(queueName string, size int)
+}
+
+type noopMetricsRecorder struct{}
+
+func (noopMetricsRecorder) MessagesFetched(queueName string, total int)               {}
+func (noopMetricsRecorder) MessageProcessed(queueName string, duration time.Duration) {}
+func (noopMetricsRecorder) MessageFailed(queueName string, duration time.Duration)    {}
+func (noopMetricsRecorder) MessageAborted(queueName string)                           {}
+func (noopMetricsRecorder) MessageDeadLettered(queueName string)                      {}
+func (noopMetricsRecorder) MessageLatency(queueName string, latency time.Duration)    {}
+func (noopMetricsRecorder) WorkersInFlight(queueName string, delta int)               {}
+func (noopMetricsRecorder) Backlog(queueName string, size int)                        {}
+
+func (c *Consumer) recordProcessed(msg Message, duration time.Duration) {
+	c.metrics.MessageProcessed(c.options.QueueName, duration)
+
+	enqueuedAt, err := time.Parse(time.RFC3339Nano, msg.EnqueuedAt)
+	if err == nil {
+		c.metrics.MessageLatency(c.options.QueueName, time.Since(enqueuedAt))
+	}
+}
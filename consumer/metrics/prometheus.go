@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector records the consumer measurements as prometheus metrics labeled
+// by queue. Set it in ConsumerOptions.Metrics and register it in your
+// registry, one collector can be shared by many consumers.
+type Collector struct {
+	fetched         *prometheus.CounterVec
+	processed       *prometheus.CounterVec
+	failed          *prometheus.CounterVec
+	aborted         *prometheus.CounterVec
+	deadLettered    *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	latency         *prometheus.HistogramVec
+	inFlight        *prometheus.GaugeVec
+	backlog         *prometheus.GaugeVec
+}
+
+type CollectorOptions struct {
+	// Namespace is the prefix of the metrics, default "pgmq_consumer".
+	Namespace              string
+	HandlerDurationBuckets []float64
+	LatencyBuckets         []float64
+}
+
+func NewCollector(options CollectorOptions) *Collector {
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = "pgmq_consumer"
+	}
+
+	handlerDurationBuckets := options.HandlerDurationBuckets
+	if handlerDurationBuckets == nil {
+		handlerDurationBuckets = prometheus.DefBuckets
+	}
+
+	latencyBuckets := options.LatencyBuckets
+	if latencyBuckets == nil {
+		latencyBuckets = prometheus.ExponentialBuckets(0.01, 4, 10)
+	}
+
+	labels := []string{"queue"}
+	return &Collector{
+		fetched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_fetched_total",
+			Help:      "Total of messages fetched from the queue.",
+		}, labels),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_processed_total",
+			Help:      "Total of messages processed with success.",
+		}, labels),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_failed_total",
+			Help:      "Total of messages whose handler returned error.",
+		}, labels),
+		aborted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_aborted_total",
+			Help:      "Total of messages aborted because the visibility time expired.",
+		}, labels),
+		deadLettered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_dead_lettered_total",
+			Help:      "Total of messages sent to the dead letter queue.",
+		}, labels),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Duration of the handler.",
+			Buckets:   handlerDurationBuckets,
+		}, []string{"queue", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "end_to_end_latency_seconds",
+			Help:      "Time between the message enqueued and processed with success.",
+			Buckets:   latencyBuckets,
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "workers_in_flight",
+			Help:      "Workers processing a message.",
+		}, labels),
+		backlog: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "channel_backlog",
+			Help:      "Messages fetched waiting a worker.",
+		}, labels),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.fetched,
+		c.processed,
+		c.failed,
+		c.aborted,
+		c.deadLettered,
+		c.handlerDuration,
+		c.latency,
+		c.inFlight,
+		c.backlog,
+	}
+}
+
+func (c *Collector) Describe(descs chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(descs)
+	}
+}
+
+func (c *Collector) Collect(metrics chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(metrics)
+	}
+}
+
+func (c *Collector) MessagesFetched(queueName string, total int) {
+	c.fetched.WithLabelValues(queueName).Add(float64(total))
+}
+
+func (c *Collector) MessageProcessed(queueName string, duration time.Duration) {
+	c.processed.WithLabelValues(queueName).Inc()
+	c.handlerDuration.WithLabelValues(queueName, "success").Observe(duration.Seconds())
+}
+
+func (c *Collector) MessageFailed(queueName string, duration time.Duration) {
+	c.failed.WithLabelValues(queueName).Inc()
+	c.handlerDuration.WithLabelValues(queueName, "error").Observe(duration.Seconds())
+}
+
+func (c *Collector) MessageAborted(queueName string) {
+	c.aborted.WithLabelValues(queueName).Inc()
+}
+
+func (c *Collector) MessageDeadLettered(queueName string) {
+	c.deadLettered.WithLabelValues(queueName).Inc()
+}
+
+func (c *Collector) MessageLatency(queueName string, latency time.Duration) {
+	c.latency.WithLabelValues(queueName).Observe(latency.Seconds())
+}
+
+func (c *Collector) WorkersInFlight(queueName string, delta int) {
+	c.inFlight.WithLabelValues(queueName).Add(float64(delta))
+}
+
+func (c *Collector) Backlog(queueName string, size int) {
+	c.backlog.WithLabelValues(queueName).Set(float64(size))
+}
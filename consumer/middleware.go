@@ -0,0 +1,111 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps the handler. ConsumerOptions.Middlewares are applied in
+// order, the first one is the outermost.
+type Middleware func(next Handler) Handler
+
+func chainMiddlewares(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// PanicError is returned by RecoverMiddleware when the handler panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", e.Value)
+}
+
+// ValidationError is returned by ValidationMiddleware. Like DecodeError,
+// messages failing with it are sent to the dlq immediately.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid message: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func isInvalidMessage(err error) bool {
+	var decodeErr *DecodeError
+	var validationErr *ValidationError
+	return errors.As(err, &decodeErr) || errors.As(err, &validationErr)
+}
+
+// RecoverMiddleware converts a panic of the handler in a *PanicError, so
+// the message is retried as any other error instead of crashing the process.
+func RecoverMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) (err error) {
+			defer func() {
+				if value := recover(); value != nil {
+					err = &PanicError{Value: value, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// TimingMiddleware calls observe with the duration of the handler.
+func TimingMiddleware(observe func(msg Message, duration time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) error {
+			startedAt := time.Now()
+			err := next(ctx, msg)
+			observe(msg, time.Since(startedAt), err)
+			return err
+		}
+	}
+}
+
+// ValidationMiddleware calls validate before the handler, the invalid
+// messages are not retried.
+func ValidationMiddleware(validate func(msg Message) error) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) error {
+			if err := validate(msg); err != nil {
+				return &ValidationError{Err: err}
+			}
+			return next(ctx, msg)
+		}
+	}
+}
+
+// LoggingMiddleware logs the start and the end of each message.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) error {
+			messageLogger := logger.With("msg_id", msg.MsgID, "read_ct", msg.ReadCT)
+			messageLogger.InfoContext(ctx, "message received")
+
+			startedAt := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				messageLogger.WarnContext(ctx, "message failed", "duration", time.Since(startedAt), "error", err)
+				return err
+			}
+
+			messageLogger.InfoContext(ctx, "message handled", "duration", time.Since(startedAt))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package consumer
+
+import (
+	"context"
+	"time"
+)
+
+const DEFAULT_TIME_MS_SAFETY_POLLING = 30000
+
+// Notifier wakes up the consumer when messages are sent to the queue, so it
+// doesn't need to poll an empty queue. The channel receives a value for one
+// or more messages sent and stops when ctx is cancelled.
+type Notifier interface {
+	Listen(ctx context.Context, queueName string) (<-chan struct{}, error)
+}
+
+// listen returns nil when the consumer uses the sleep based polling. The
+// listener is stopped when the consumer stops.
+func (c *Consumer) listen() (<-chan struct{}, context.CancelFunc) {
+	if c.options.Notifier == nil || !c.options.EnabledPolling {
+		return nil, func() {}
+	}
+
+	ctx, cancel := c.stoppingContext()
+	notifications, err := c.options.Notifier.Listen(ctx, c.options.QueueName)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.notifyDriverError(DRIVER_OPERATION_LISTEN, c.options.QueueName, Message{}, err)
+		}
+		return nil, cancel
+	}
+	c.logger.Debug("listening notifications of new messages")
+	return notifications, cancel
+}
+
+// waitNotification waits a notification or the safety polling, in case a
+// notification is lost.
+func (c *Consumer) waitNotification(notifications <-chan struct{}) {
+	safetyPolling := time.Duration(c.options.TimeMsSafetyPolling) * time.Millisecond
+	if safetyPolling <= 0 {
+		safetyPolling = DEFAULT_TIME_MS_SAFETY_POLLING * time.Millisecond
+	}
+
+	timer := time.NewTimer(safetyPolling)
+	defer timer.Stop()
+
+	select {
+	case <-notifications:
+	case <-timer.C:
+	case <-c.stopping:
+	}
+}
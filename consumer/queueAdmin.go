@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// QueueAdmin is implemented by queue drivers able to manage the queues with
+// the pgmq functions create, create_unlogged, create_partitioned,
+// drop_queue, purge_queue, list_queues and metrics.
+type QueueAdmin interface {
+	CreateQueueContext(ctx context.Context, queueName string) error
+	CreateUnloggedQueue(ctx context.Context, queueName string) error
+	// CreatePartitionedQueue needs the pg_partman extension. The intervals
+	// are numbers of messages, like "10000", or durations, like "1 day".
+	CreatePartitionedQueue(ctx context.Context, queueName string, partitionInterval string, retentionInterval string) error
+	// DropQueue returns false when the queue doesn't exist.
+	DropQueue(ctx context.Context, queueName string) (bool, error)
+	// PurgeQueue deletes all the messages and returns how many were deleted.
+	PurgeQueue(ctx context.Context, queueName string) (int64, error)
+	ListQueues(ctx context.Context) ([]QueueInfo, error)
+	Metrics(ctx context.Context, queueName string) (QueueMetrics, error)
+}
+
+type QueueInfo struct {
+	QueueName     string    `json:"queue_name"`
+	IsPartitioned bool      `json:"is_partitioned"`
+	IsUnlogged    bool      `json:"is_unlogged"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// QueueMetrics are the metrics of pgmq. The ages are nil when the queue is
+// empty and QueueVisibleLength is filled since pgmq 1.5.
+type QueueMetrics struct {
+	QueueName          string    `json:"queue_name"`
+	QueueLength        int64     `json:"queue_length"`
+	QueueVisibleLength int64     `json:"queue_visible_length"`
+	NewestMsgAgeSec    *int64    `json:"newest_msg_age_sec"`
+	OldestMsgAgeSec    *int64    `json:"oldest_msg_age_sec"`
+	TotalMessages      int64     `json:"total_messages"`
+	ScrapeTime         time.Time `json:"scrape_time"`
+}
+
+func validateEnsureQueues(options ConsumerOptions, queueDriver QueueDriver) error {
+	if !options.EnsureQueues {
+		return nil
+	}
+	if _, ok := queueDriver.(QueueAdmin); !ok {
+		return errors.New("EnsureQueues requires a queue driver implementing QueueAdmin")
+	}
+	return nil
+}
+
+// ensureQueues creates the queue and the dlq when they don't exist.
+func ensureQueues(ctx context.Context, options ConsumerOptions, queueDriver QueueDriver) error {
+	if !options.EnsureQueues {
+		return nil
+	}
+
+	queueAdmin := queueDriver.(QueueAdmin)
+	queueNames := []string{options.QueueName}
+	if options.QueueNameDlq != "" {
+		queueNames = append(queueNames, options.QueueNameDlq)
+	}
+
+	for _, queueName := range queueNames {
+		if err := queueAdmin.CreateQueueContext(ctx, queueName); err != nil {
+			return &DriverError{Operation: DRIVER_OPERATION_CREATE, QueueName: queueName, Err: err}
+		}
+	}
+	return nil
+}
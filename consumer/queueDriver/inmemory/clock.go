@@ -0,0 +1,46 @@
+package inmemory
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock decides when the messages are visible.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock only moves when Advance or Set is called, so the visibility
+// time and the delays can be tested without waiting.
+type ManualClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (m *ManualClock) Now() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.now
+}
+
+func (m *ManualClock) Advance(duration time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = m.now.Add(duration)
+}
+
+func (m *ManualClock) Set(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = now
+}
@@ -0,0 +1,467 @@
+package inmemory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+type InMemoryOptions struct {
+	// Clock default is the system clock.
+	Clock Clock
+}
+
+// InMemoryQueueDriver emulates pgmq in memory: messages are invisible until
+// the delay and the visibility time pass, read increments read_ct, pop
+// deletes and archive keeps the message in the archive of the queue.
+type InMemoryQueueDriver struct {
+	mutex  sync.Mutex
+	clock  Clock
+	queues map[string]*queue
+}
+
+type queue struct {
+	info      consumer.QueueInfo
+	lastMsgID int64
+	messages  map[int64]*storedMessage
+	archive   []consumer.Message
+	listeners []chan struct{}
+}
+
+type storedMessage struct {
+	msgID      int64
+	readCT     int64
+	enqueuedAt time.Time
+	vt         time.Time
+	body       json.RawMessage
+	headers    map[string]interface{}
+}
+
+func NewInMemoryQueueDriver(options InMemoryOptions) *InMemoryQueueDriver {
+	clock := options.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &InMemoryQueueDriver{clock: clock, queues: map[string]*queue{}}
+}
+
+// CreateQueue creates the queue, like pgmq the operations on a queue not
+// created return error.
+func (d *InMemoryQueueDriver) CreateQueue(queueName string) error {
+	return d.createQueue(consumer.QueueInfo{QueueName: queueName})
+}
+
+func (d *InMemoryQueueDriver) CreateQueueContext(ctx context.Context, queueName string) error {
+	return d.CreateQueue(queueName)
+}
+
+func (d *InMemoryQueueDriver) CreateUnloggedQueue(ctx context.Context, queueName string) error {
+	return d.createQueue(consumer.QueueInfo{QueueName: queueName, IsUnlogged: true})
+}
+
+// CreatePartitionedQueue only marks the queue as partitioned, the intervals
+// are ignored.
+func (d *InMemoryQueueDriver) CreatePartitionedQueue(ctx context.Context, queueName string, partitionInterval string, retentionInterval string) error {
+	return d.createQueue(consumer.QueueInfo{QueueName: queueName, IsPartitioned: true})
+}
+
+func (d *InMemoryQueueDriver) createQueue(info consumer.QueueInfo) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.queues[info.QueueName]; !ok {
+		info.CreatedAt = d.clock.Now()
+		d.queues[info.QueueName] = &queue{info: info, messages: map[int64]*storedMessage{}}
+	}
+	return nil
+}
+
+func (d *InMemoryQueueDriver) DropQueue(ctx context.Context, queueName string) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.queues[queueName]; !ok {
+		return false, nil
+	}
+	delete(d.queues, queueName)
+	return true, nil
+}
+
+func (d *InMemoryQueueDriver) PurgeQueue(ctx context.Context, queueName string) (int64, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := int64(len(q.messages))
+	q.messages = map[int64]*storedMessage{}
+	return purged, nil
+}
+
+func (d *InMemoryQueueDriver) ListQueues(ctx context.Context) ([]consumer.QueueInfo, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	queues := make([]consumer.QueueInfo, 0, len(d.queues))
+	for _, q := range d.queues {
+		queues = append(queues, q.info)
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].QueueName < queues[j].QueueName
+	})
+	return queues, nil
+}
+
+func (d *InMemoryQueueDriver) Metrics(ctx context.Context, queueName string) (consumer.QueueMetrics, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return consumer.QueueMetrics{}, err
+	}
+
+	now := d.clock.Now()
+	metrics := consumer.QueueMetrics{
+		QueueName:          queueName,
+		QueueLength:        int64(len(q.messages)),
+		QueueVisibleLength: int64(len(q.visible(now, len(q.messages)))),
+		TotalMessages:      q.lastMsgID,
+		ScrapeTime:         now,
+	}
+
+	messages := q.sorted()
+	if len(messages) > 0 {
+		newestAge := int64(now.Sub(messages[len(messages)-1].enqueuedAt) / time.Second)
+		oldestAge := int64(now.Sub(messages[0].enqueuedAt) / time.Second)
+		metrics.NewestMsgAgeSec = &newestAge
+		metrics.OldestMsgAgeSec = &oldestAge
+	}
+	return metrics, nil
+}
+
+func (d *InMemoryQueueDriver) queue(queueName string) (*queue, error) {
+	q, ok := d.queues[queueName]
+	if !ok {
+		return nil, fmt.Errorf("queue %s does not exist", queueName)
+	}
+	return q, nil
+}
+
+func (d *InMemoryQueueDriver) Send(queueName string, message map[string]interface{}, signal context.Context) error {
+	return d.SendWithHeaders(queueName, message, nil, signal)
+}
+
+func (d *InMemoryQueueDriver) SendWithHeaders(
+	queueName string,
+	message map[string]interface{},
+	headers map[string]interface{},
+	signal context.Context,
+) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var allHeaders []map[string]interface{}
+	if headers != nil {
+		allHeaders = []map[string]interface{}{headers}
+	}
+	_, err = d.SendMessages(queueName, []json.RawMessage{body}, allHeaders, 0, signal)
+	return err
+}
+
+func (d *InMemoryQueueDriver) SendBatch(queueName string, messages []map[string]interface{}, signal context.Context) error {
+	bodies := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		body, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, body)
+	}
+
+	_, err := d.SendMessages(queueName, bodies, nil, 0, signal)
+	return err
+}
+
+func (d *InMemoryQueueDriver) SendMessages(
+	queueName string,
+	messages []json.RawMessage,
+	headers []map[string]interface{},
+	delaySeconds int,
+	signal context.Context,
+) ([]int64, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.clock.Now()
+	msgIDs := make([]int64, 0, len(messages))
+	for i, body := range messages {
+		q.lastMsgID++
+		message := &storedMessage{
+			msgID:      q.lastMsgID,
+			enqueuedAt: now,
+			vt:         now.Add(time.Duration(delaySeconds) * time.Second),
+			body:       append(json.RawMessage(nil), body...),
+		}
+		if i < len(headers) {
+			message.headers = headers[i]
+		}
+		q.messages[message.msgID] = message
+		msgIDs = append(msgIDs, message.msgID)
+	}
+
+	for _, listener := range q.listeners {
+		select {
+		case listener <- struct{}{}:
+		default:
+		}
+	}
+	return msgIDs, nil
+}
+
+// Listen notifies the messages sent to the queue, like the insert
+// notifications of pgmq.
+func (d *InMemoryQueueDriver) Listen(ctx context.Context, queueName string) (<-chan struct{}, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make(chan struct{}, 1)
+	q.listeners = append(q.listeners, notifications)
+
+	context.AfterFunc(ctx, func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		q.listeners = slices.DeleteFunc(q.listeners, func(listener chan struct{}) bool {
+			return listener == notifications
+		})
+	})
+	return notifications, nil
+}
+
+// Get reads the visible messages in the order they were sent, increments
+// their read_ct and hides them for visibilityTime seconds.
+func (d *InMemoryQueueDriver) Get(queueName string, visibilityTime int, totalMessages int) ([]consumer.Message, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.clock.Now()
+	visible := q.visible(now, totalMessages)
+	messages := make([]consumer.Message, 0, len(visible))
+	for _, message := range visible {
+		message.readCT++
+		message.vt = now.Add(time.Duration(visibilityTime) * time.Second)
+		messages = append(messages, message.toMessage())
+	}
+	return messages, nil
+}
+
+// ReadWithPoll waits up to maxPollSeconds for visible messages, checking
+// the queue when a message is sent and every pollIntervalMs.
+func (d *InMemoryQueueDriver) ReadWithPoll(
+	ctx context.Context,
+	queueName string,
+	visibilityTime int,
+	totalMessages int,
+	maxPollSeconds int,
+	pollIntervalMs int,
+) ([]consumer.Message, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	notifications, err := d.Listen(ctx, queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.NewTimer(time.Duration(maxPollSeconds) * time.Second)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(time.Duration(pollIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		messages, err := d.Get(queueName, visibilityTime, totalMessages)
+		if err != nil || len(messages) > 0 {
+			return messages, err
+		}
+
+		select {
+		case <-notifications:
+		case <-ticker.C:
+		case <-deadline.C:
+			return d.Get(queueName, visibilityTime, totalMessages)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Pop reads and deletes one visible message.
+func (d *InMemoryQueueDriver) Pop(queueName string) ([]consumer.Message, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := q.visible(d.clock.Now(), 1)
+	messages := make([]consumer.Message, 0, len(visible))
+	for _, message := range visible {
+		delete(q.messages, message.msgID)
+		messages = append(messages, message.toMessage())
+	}
+	return messages, nil
+}
+
+func (d *InMemoryQueueDriver) Delete(queueName string, messageID int64) error {
+	return d.DeleteBatch(queueName, []int64{messageID})
+}
+
+func (d *InMemoryQueueDriver) DeleteBatch(queueName string, messageIDs []int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return err
+	}
+
+	for _, messageID := range messageIDs {
+		delete(q.messages, messageID)
+	}
+	return nil
+}
+
+func (d *InMemoryQueueDriver) Archive(queueName string, messageID int64) error {
+	return d.ArchiveBatch(queueName, []int64{messageID})
+}
+
+func (d *InMemoryQueueDriver) ArchiveBatch(queueName string, messageIDs []int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return err
+	}
+
+	for _, messageID := range messageIDs {
+		message, ok := q.messages[messageID]
+		if !ok {
+			continue
+		}
+		delete(q.messages, messageID)
+		q.archive = append(q.archive, message.toMessage())
+	}
+	return nil
+}
+
+func (d *InMemoryQueueDriver) SetVisibilityTime(queueName string, messageID int64, visibilityTime int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return err
+	}
+
+	if message, ok := q.messages[messageID]; ok {
+		message.vt = d.clock.Now().Add(time.Duration(visibilityTime) * time.Second)
+	}
+	return nil
+}
+
+// Messages returns the messages of the queue, visible or not, without
+// changing them.
+func (d *InMemoryQueueDriver) Messages(queueName string) []consumer.Message {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return nil
+	}
+
+	messages := make([]consumer.Message, 0, len(q.messages))
+	for _, message := range q.sorted() {
+		messages = append(messages, message.toMessage())
+	}
+	return messages
+}
+
+// Archived returns the messages archived in the queue.
+func (d *InMemoryQueueDriver) Archived(queueName string) []consumer.Message {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	q, err := d.queue(queueName)
+	if err != nil {
+		return nil
+	}
+	return append([]consumer.Message(nil), q.archive...)
+}
+
+func (q *queue) sorted() []*storedMessage {
+	messages := make([]*storedMessage, 0, len(q.messages))
+	for _, message := range q.messages {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].msgID < messages[j].msgID
+	})
+	return messages
+}
+
+func (q *queue) visible(now time.Time, limit int) []*storedMessage {
+	var visible []*storedMessage
+	for _, message := range q.sorted() {
+		if len(visible) >= limit {
+			break
+		}
+		if !message.vt.After(now) {
+			visible = append(visible, message)
+		}
+	}
+	return visible
+}
+
+func (m *storedMessage) toMessage() consumer.Message {
+	message := consumer.Message{
+		MsgID:      m.msgID,
+		ReadCT:     m.readCT,
+		EnqueuedAt: m.enqueuedAt.Format(time.RFC3339Nano),
+		VT:         m.vt.Format(time.RFC3339Nano),
+		Headers:    m.headers,
+		Raw:        append(json.RawMessage(nil), m.body...),
+	}
+	json.Unmarshal(m.body, &message.Message)
+	return message
+}
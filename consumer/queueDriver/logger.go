@@ -0,0 +1,41 @@
+package queuedriver
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// driverLogger is shared by a driver and the drivers returned by WithTx, so
+// it is safe to set while the driver is in use.
+type driverLogger struct {
+	logger atomic.Pointer[slog.Logger]
+}
+
+func (l *driverLogger) current() *slog.Logger {
+	if logger := l.logger.Load(); logger != nil {
+		return logger
+	}
+	return discardLogger
+}
+
+func (l *driverLogger) set(logger *slog.Logger) {
+	l.logger.Store(logger)
+}
+
+// setDefault keeps the logger set before, the consumer uses it to pass its
+// logger without replacing the one set with SetLogger.
+func (l *driverLogger) setDefault(logger *slog.Logger) {
+	l.logger.CompareAndSwap(nil, logger)
+}
+
+func logOperation(logger *slog.Logger, operation string, queueName string, startedAt time.Time, err *error, attrs ...any) {
+	attrs = append(attrs, "operation", operation, "queue", queueName, "duration", time.Since(startedAt))
+	if *err != nil {
+		logger.Error("queue driver operation failed", append(attrs, "error", *err)...)
+		return
+	}
+	logger.Debug("queue driver operation executed", attrs...)
+}
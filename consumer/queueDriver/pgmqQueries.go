@@ -0,0 +1,124 @@
+package queuedriver
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// The sql of the pgmq functions is shared by the lib/pq and the pgx drivers.
+// delay and vt are cast to integer because pgmq 1.5 overloads send,
+// send_batch and set_vt with timestamptz.
+
+const supportsHeadersQuery = `SELECT EXISTS (
+	SELECT 1 FROM pg_proc
+	JOIN pg_namespace ON pg_namespace.oid = pg_proc.pronamespace
+	WHERE pg_namespace.nspname = $1
+	AND pg_proc.proname = 'send'
+	AND 'headers' = ANY(pg_proc.proargnames)
+);`
+
+func readQuery(schema string) string {
+	return fmt.Sprintf(`SELECT * FROM %s.read(
+		queue_name => $1,
+		vt         => $2,
+		qty        => $3
+	);`, schema)
+}
+
+func readWithPollQuery(schema string) string {
+	return fmt.Sprintf(`SELECT * FROM %s.read_with_poll(
+		queue_name       => $1,
+		vt               => $2,
+		qty              => $3,
+		max_poll_seconds => $4,
+		poll_interval_ms => $5
+	);`, schema)
+}
+
+func popQuery(schema string) string {
+	return fmt.Sprintf(`SELECT * FROM %s.pop(
+		queue_name => $1
+	);`, schema)
+}
+
+// completeQuery is the sql of delete and archive, of one message or of an
+// array of messages.
+func completeQuery(schema string, function string, batch bool) string {
+	if batch {
+		return fmt.Sprintf(`SELECT * FROM %s.%s(
+			queue_name => $1,
+			msg_ids    => $2
+		);`, schema, function)
+	}
+	return fmt.Sprintf(`SELECT * FROM %s.%s(
+		queue_name => $1,
+		msg_id     => $2
+	);`, schema, function)
+}
+
+func setVisibilityTimeQuery(schema string) string {
+	return fmt.Sprintf(`SELECT * FROM %s.set_vt(
+		queue_name => $1,
+		msg_id     => $2,
+		vt         => $3::integer
+	);`, schema)
+}
+
+func sendQuery(schema string, withHeaders bool) string {
+	if withHeaders {
+		return fmt.Sprintf(`SELECT * FROM %s.send(
+			queue_name => $1,
+			msg        => $2,
+			headers    => $3,
+			delay      => $4::integer
+		);`, schema)
+	}
+	return fmt.Sprintf(`SELECT * FROM %s.send(
+		queue_name => $1,
+		msg        => $2,
+		delay      => $3::integer
+	);`, schema)
+}
+
+func sendBatchQuery(schema string, withHeaders bool) string {
+	if withHeaders {
+		return fmt.Sprintf(`SELECT * FROM %s.send_batch(
+			queue_name => $1,
+			msgs       => $2::jsonb[],
+			headers    => $3::jsonb[],
+			delay      => $4::integer
+		);`, schema)
+	}
+	return fmt.Sprintf(`SELECT * FROM %s.send_batch(
+		queue_name => $1,
+		msgs       => $2::jsonb[],
+		delay      => $3::integer
+	);`, schema)
+}
+
+type headersSupport struct {
+	mutex     sync.Mutex
+	supported *bool
+}
+
+// check runs query once, the drivers returned by WithTx share the result.
+func (h *headersSupport) check(logger *slog.Logger, query func() (bool, error)) (bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.supported != nil {
+		return *h.supported, nil
+	}
+
+	supported, err := query()
+	if err != nil {
+		return false, err
+	}
+
+	if !supported {
+		logger.Warn("installed pgmq version has no headers support, headers are discarded")
+	}
+	h.supported = &supported
+	return supported, nil
+}
@@ -0,0 +1,374 @@
+package queuedriver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+// PgxDBTX is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type PgxDBTX interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+}
+
+// PgxQueueDriver is the queue driver over pgx. The messages and the headers
+// are decoded from the binary jsonb and the timestamps from timestamptz, and
+// the acks of different completion modes are pipelined in one round trip.
+// The option Transactional is available only with PostgresQueueDriver.
+type PgxQueueDriver struct {
+	pool    *pgxpool.Pool
+	db      PgxDBTX
+	schema  string
+	logger  *driverLogger
+	headers *headersSupport
+}
+
+func NewPgxQueueDriver(pool *pgxpool.Pool, schema string) *PgxQueueDriver {
+	if schema == "" {
+		schema = "pgmq"
+	}
+	return &PgxQueueDriver{
+		pool:    pool,
+		db:      pool,
+		schema:  schema,
+		logger:  &driverLogger{},
+		headers: &headersSupport{},
+	}
+}
+
+// WithTx returns a driver running the operations in tx, for example to send
+// a message in the same transaction of the writes of your service.
+func (p *PgxQueueDriver) WithTx(tx PgxDBTX) *PgxQueueDriver {
+	return &PgxQueueDriver{
+		pool:    p.pool,
+		db:      tx,
+		schema:  p.schema,
+		logger:  p.logger,
+		headers: p.headers,
+	}
+}
+
+func (p *PgxQueueDriver) SetLogger(logger *slog.Logger) {
+	p.logger.set(logger)
+}
+
+// SetDefaultLogger sets the logger only if SetLogger was not called.
+func (p *PgxQueueDriver) SetDefaultLogger(logger *slog.Logger) {
+	p.logger.setDefault(logger)
+}
+
+func (p *PgxQueueDriver) Get(queueName string, visibilityTime int, totalMessages int) (result []consumer.Message, err error) {
+	defer logOperation(p.logger.current(), "read", queueName, time.Now(), &err)
+
+	rows, err := p.db.Query(context.Background(), readQuery(p.schema), queueName, visibilityTime, totalMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPgxMessages(rows)
+}
+
+// ReadWithPoll waits on the server up to maxPollSeconds for messages.
+// Cancelling ctx cancels the query, so the messages are not read.
+func (p *PgxQueueDriver) ReadWithPoll(
+	ctx context.Context,
+	queueName string,
+	visibilityTime int,
+	totalMessages int,
+	maxPollSeconds int,
+	pollIntervalMs int,
+) (result []consumer.Message, err error) {
+	defer logOperation(p.logger.current(), "read_with_poll", queueName, time.Now(), &err)
+
+	rows, err := p.db.Query(ctx, readWithPollQuery(p.schema), queueName, visibilityTime, totalMessages, maxPollSeconds, pollIntervalMs)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPgxMessages(rows)
+}
+
+func (p *PgxQueueDriver) Pop(queueName string) (result []consumer.Message, err error) {
+	defer logOperation(p.logger.current(), "pop", queueName, time.Now(), &err)
+
+	rows, err := p.db.Query(context.Background(), popQuery(p.schema), queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPgxMessages(rows)
+}
+
+// scanPgxMessages reads the columns by name, so the headers column is read
+// when the installed pgmq version has it.
+func scanPgxMessages(rows pgx.Rows) ([]consumer.Message, error) {
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	var messages []consumer.Message
+	for rows.Next() {
+		var message consumer.Message
+		var enqueuedAt time.Time
+		var vt time.Time
+
+		destinations := make([]any, len(fields))
+		for i, field := range fields {
+			switch field.Name {
+			case "msg_id":
+				destinations[i] = &message.MsgID
+			case "read_ct":
+				destinations[i] = &message.ReadCT
+			case "enqueued_at":
+				destinations[i] = &enqueuedAt
+			case "vt":
+				destinations[i] = &vt
+			case "message":
+				destinations[i] = &message.Raw
+			case "headers":
+				destinations[i] = &message.Headers
+			default:
+				destinations[i] = new(any)
+			}
+		}
+
+		if err := rows.Scan(destinations...); err != nil {
+			return nil, err
+		}
+
+		message.EnqueuedAt = enqueuedAt.Format(time.RFC3339Nano)
+		message.VT = vt.Format(time.RFC3339Nano)
+		json.Unmarshal(message.Raw, &message.Message)
+
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (p *PgxQueueDriver) Delete(queueName string, msgID int64) (err error) {
+	defer logOperation(p.logger.current(), "delete", queueName, time.Now(), &err, "msg_id", msgID)
+
+	_, err = p.db.Exec(context.Background(), completeQuery(p.schema, "delete", false), queueName, msgID)
+	return err
+}
+
+func (p *PgxQueueDriver) Archive(queueName string, msgID int64) (err error) {
+	defer logOperation(p.logger.current(), "archive", queueName, time.Now(), &err, "msg_id", msgID)
+
+	_, err = p.db.Exec(context.Background(), completeQuery(p.schema, "archive", false), queueName, msgID)
+	return err
+}
+
+func (p *PgxQueueDriver) SetVisibilityTime(queueName string, msgID int64, visibilityTime int) (err error) {
+	defer logOperation(p.logger.current(), "set_vt", queueName, time.Now(), &err, "msg_id", msgID)
+
+	_, err = p.db.Exec(context.Background(), setVisibilityTimeQuery(p.schema), queueName, msgID, visibilityTime)
+	return err
+}
+
+func (p *PgxQueueDriver) DeleteBatch(queueName string, msgIDs []int64) error {
+	return p.CompleteBatch(queueName, msgIDs, nil)
+}
+
+func (p *PgxQueueDriver) ArchiveBatch(queueName string, msgIDs []int64) error {
+	return p.CompleteBatch(queueName, nil, msgIDs)
+}
+
+// CompleteBatch deletes and archives the messages pipelining the statements
+// in one round trip.
+func (p *PgxQueueDriver) CompleteBatch(queueName string, deleteIDs []int64, archiveIDs []int64) (err error) {
+	defer logOperation(p.logger.current(), "complete_batch", queueName, time.Now(), &err,
+		"deleted", len(deleteIDs), "archived", len(archiveIDs))
+
+	batch := &pgx.Batch{}
+	if len(deleteIDs) > 0 {
+		batch.Queue(completeQuery(p.schema, "delete", true), queueName, deleteIDs)
+	}
+	if len(archiveIDs) > 0 {
+		batch.Queue(completeQuery(p.schema, "archive", true), queueName, archiveIDs)
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	return p.db.SendBatch(context.Background(), batch).Close()
+}
+
+func (p *PgxQueueDriver) Send(queueName string, message map[string]interface{}, signal context.Context) (err error) {
+	defer logOperation(p.logger.current(), "send", queueName, time.Now(), &err)
+
+	_, err = p.db.Exec(signal, sendQuery(p.schema, false), queueName, message, 0)
+	return err
+}
+
+// SupportsHeaders checks once if the installed pgmq version has the
+// headers column, added in pgmq 1.5.
+func (p *PgxQueueDriver) SupportsHeaders(signal context.Context) (bool, error) {
+	return p.headers.check(p.logger.current(), func() (supported bool, err error) {
+		err = p.db.QueryRow(signal, supportsHeadersQuery, p.schema).Scan(&supported)
+		return supported, err
+	})
+}
+
+// SendWithHeaders sends the message without the headers when the installed
+// pgmq version doesn't support them.
+func (p *PgxQueueDriver) SendWithHeaders(queueName string, message map[string]interface{}, headers map[string]interface{}, signal context.Context,
+) (err error) {
+	supported, err := p.SupportsHeaders(signal)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return p.Send(queueName, message, signal)
+	}
+
+	defer logOperation(p.logger.current(), "send", queueName, time.Now(), &err)
+
+	_, err = p.db.Exec(signal, sendQuery(p.schema, true), queueName, message, headers, 0)
+	return err
+}
+
+func (p *PgxQueueDriver) SendBatch(queueName string, messages []map[string]interface{}, signal context.Context) error {
+	jsonMessages := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		jsonMessage, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		jsonMessages = append(jsonMessages, jsonMessage)
+	}
+
+	_, err := p.SendMessages(queueName, jsonMessages, nil, 0, signal)
+	return err
+}
+
+// SendMessages sends the messages with send_batch, visible after
+// delaySeconds, and returns their ids.
+func (p *PgxQueueDriver) SendMessages(queueName string, messages []json.RawMessage, headers []map[string]interface{}, delaySeconds int, signal context.Context,
+) (msgIDs []int64, err error) {
+	supported := false
+	if headers != nil {
+		supported, err = p.SupportsHeaders(signal)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	defer logOperation(p.logger.current(), "send_batch", queueName, time.Now(), &err)
+
+	var rows pgx.Rows
+	if supported {
+		rows, err = p.db.Query(signal, sendBatchQuery(p.schema, true), queueName, messages, headers, delaySeconds)
+	} else {
+		rows, err = p.db.Query(signal, sendBatchQuery(p.schema, false), queueName, messages, delaySeconds)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// EnableNotifyInsert makes the queue notify the listeners when messages
+// are inserted, see PostgresQueueDriver.EnableNotifyInsert.
+func (p *PgxQueueDriver) EnableNotifyInsert(ctx context.Context, queueName string) (err error) {
+	defer logOperation(p.logger.current(), "enable_notify_insert", queueName, time.Now(), &err)
+
+	return enableNotifyInsert(ctx, func(ctx context.Context, query string, args ...any) error {
+		_, err := p.db.Exec(ctx, query, args...)
+		return err
+	}, p.schema, queueName)
+}
+
+// Listen listens the notifications of messages inserted in the queue on a
+// connection acquired from the pool, reconnecting when the connection is
+// lost. The connection is closed when ctx is cancelled, so the LISTEN doesn't
+// go back to the pool.
+func (p *PgxQueueDriver) Listen(ctx context.Context, queueName string) (<-chan struct{}, error) {
+	if p.pool == nil {
+		return nil, errors.New("driver created with WithTx cannot listen")
+	}
+
+	conn, err := p.listen(ctx, queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case notifications <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		for {
+			_, err := conn.Conn().WaitForNotification(ctx)
+			if err == nil {
+				notify()
+				continue
+			}
+
+			conn.Hijack().Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+
+			p.logger.current().Error("listener connection error", "queue", queueName, "error", err)
+			conn = p.reconnect(ctx, queueName)
+			if conn == nil {
+				return
+			}
+			// notifications could be lost while reconnecting, so the consumer reads too
+			notify()
+		}
+	}()
+	return notifications, nil
+}
+
+func (p *PgxQueueDriver) listen(ctx context.Context, queueName string) (*pgxpool.Conn, error) {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := pgx.Identifier{NotifyChannel(queueName)}.Sanitize()
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		conn.Hijack().Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *PgxQueueDriver) reconnect(ctx context.Context, queueName string) *pgxpool.Conn {
+	wait := 100 * time.Millisecond
+	for {
+		conn, err := p.listen(ctx, queueName)
+		if err == nil {
+			return conn
+		}
+
+		p.logger.current().Error("listener connection error", "queue", queueName, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil
+		}
+		wait = min(wait*2, time.Minute)
+	}
+}
@@ -0,0 +1,134 @@
+package queuedriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+const POSTGRES_UNDEFINED_FUNCTION = "42883"
+
+// PostgresNotifier listens the notifications of messages inserted in the
+// queue, sent by the trigger created with EnableNotifyInsert. LISTEN needs
+// a dedicated connection, so it is created from the connection string.
+type PostgresNotifier struct {
+	dsn    string
+	logger *driverLogger
+}
+
+func NewPostgresNotifier(dsn string) *PostgresNotifier {
+	return &PostgresNotifier{dsn: dsn, logger: &driverLogger{}}
+}
+
+func (p *PostgresNotifier) SetLogger(logger *slog.Logger) {
+	p.logger.set(logger)
+}
+
+// SetDefaultLogger sets the logger only if SetLogger was not called.
+func (p *PostgresNotifier) SetDefaultLogger(logger *slog.Logger) {
+	p.logger.setDefault(logger)
+}
+
+// NotifyChannel is the channel notified by pgmq when a message is inserted
+// in the queue.
+func NotifyChannel(queueName string) string {
+	return "pgmq.q_" + queueName + ".INSERT"
+}
+
+func (p *PostgresNotifier) Listen(ctx context.Context, queueName string) (<-chan struct{}, error) {
+	listener := pq.NewListener(p.dsn, 100*time.Millisecond, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			p.logger.current().Error("listener connection error", "queue", queueName, "error", err)
+		}
+	})
+
+	// Listen blocks until the connection is established
+	listening := make(chan error, 1)
+	go func() {
+		listening <- listener.Listen(NotifyChannel(queueName))
+	}()
+	select {
+	case err := <-listening:
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	case <-ctx.Done():
+		listener.Close()
+		return nil, ctx.Err()
+	}
+
+	notifications := make(chan struct{}, 1)
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-listener.Notify:
+				// a nil notification means the connection was reestablished
+				// and notifications could be lost, so the consumer reads too
+				select {
+				case notifications <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return notifications, nil
+}
+
+// EnableNotifyInsert makes the queue notify the listeners when messages
+// are inserted, using pgmq.enable_notify_insert when the installed pgmq has
+// it, otherwise creating an equivalent trigger.
+func (p *PostgresQueueDriver) EnableNotifyInsert(ctx context.Context, queueName string) (err error) {
+	defer logOperation(p.logger.current(), "enable_notify_insert", queueName, time.Now(), &err)
+
+	return enableNotifyInsert(ctx, func(ctx context.Context, query string, args ...any) error {
+		_, err := p.db.ExecContext(ctx, query, args...)
+		return err
+	}, p.schema, queueName)
+}
+
+func enableNotifyInsert(
+	ctx context.Context,
+	exec func(ctx context.Context, query string, args ...any) error,
+	schema string,
+	queueName string,
+) error {
+	err := exec(ctx, fmt.Sprintf(`SELECT %s.enable_notify_insert($1);`, schema), queueName)
+	if !isUndefinedFunction(err) {
+		return err
+	}
+
+	err = exec(ctx, fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s.notify_queue_listeners()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			PERFORM pg_notify('pgmq.' || TG_TABLE_NAME || '.' || TG_OP, NULL);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;`, schema))
+	if err != nil {
+		return err
+	}
+
+	return exec(ctx, fmt.Sprintf(`CREATE OR REPLACE TRIGGER trigger_notify_queue_insert_listeners
+		AFTER INSERT ON %[1]s.%[2]s
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE %[1]s.notify_queue_listeners();`, schema, pq.QuoteIdentifier("q_"+queueName)))
+}
+
+func isUndefinedFunction(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == POSTGRES_UNDEFINED_FUNCTION
+	}
+
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == POSTGRES_UNDEFINED_FUNCTION
+}
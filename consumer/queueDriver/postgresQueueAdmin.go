@@ -0,0 +1,234 @@
+package queuedriver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+func (p *PostgresQueueDriver) CreateQueueContext(ctx context.Context, queueName string) (err error) {
+	defer logOperation(p.logger.current(), "create", queueName, time.Now(), &err)
+
+	_, err = p.db.ExecContext(ctx, fmt.Sprintf(`SELECT %s.create(queue_name => $1);`, p.schema), queueName)
+	return err
+}
+
+func (p *PostgresQueueDriver) CreateUnloggedQueue(ctx context.Context, queueName string) (err error) {
+	defer logOperation(p.logger.current(), "create_unlogged", queueName, time.Now(), &err)
+
+	_, err = p.db.ExecContext(ctx, fmt.Sprintf(`SELECT %s.create_unlogged(queue_name => $1);`, p.schema), queueName)
+	return err
+}
+
+func (p *PostgresQueueDriver) CreatePartitionedQueue(ctx context.Context, queueName string, partitionInterval string, retentionInterval string) (err error) {
+	defer logOperation(p.logger.current(), "create_partitioned", queueName, time.Now(), &err)
+
+	_, err = p.db.ExecContext(ctx, fmt.Sprintf(`SELECT %s.create_partitioned(
+		queue_name         => $1,
+		partition_interval => $2,
+		retention_interval => $3
+	);`, p.schema), queueName, partitionInterval, retentionInterval)
+	return err
+}
+
+func (p *PostgresQueueDriver) DropQueue(ctx context.Context, queueName string) (dropped bool, err error) {
+	defer logOperation(p.logger.current(), "drop_queue", queueName, time.Now(), &err)
+
+	err = p.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s.drop_queue(queue_name => $1);`, p.schema), queueName).Scan(&dropped)
+	return dropped, err
+}
+
+func (p *PostgresQueueDriver) PurgeQueue(ctx context.Context, queueName string) (purged int64, err error) {
+	defer logOperation(p.logger.current(), "purge_queue", queueName, time.Now(), &err)
+
+	err = p.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s.purge_queue(queue_name => $1);`, p.schema), queueName).Scan(&purged)
+	return purged, err
+}
+
+func (p *PostgresQueueDriver) ListQueues(ctx context.Context) (queues []consumer.QueueInfo, err error) {
+	defer logOperation(p.logger.current(), "list_queues", "", time.Now(), &err)
+
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s.list_queues();`, p.schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var queue consumer.QueueInfo
+		if err := rows.Scan(queueInfoDestinations(&queue, columns)...); err != nil {
+			return nil, err
+		}
+		queues = append(queues, queue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return queues, nil
+}
+
+func (p *PostgresQueueDriver) Metrics(ctx context.Context, queueName string) (metrics consumer.QueueMetrics, err error) {
+	defer logOperation(p.logger.current(), "metrics", queueName, time.Now(), &err)
+
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s.metrics(queue_name => $1);`, p.schema), queueName)
+	if err != nil {
+		return metrics, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return metrics, err
+	}
+
+	if rows.Next() {
+		if err := rows.Scan(queueMetricsDestinations(&metrics, columns)...); err != nil {
+			return metrics, err
+		}
+	}
+	return metrics, rows.Err()
+}
+
+func (p *PgxQueueDriver) CreateQueueContext(ctx context.Context, queueName string) (err error) {
+	defer logOperation(p.logger.current(), "create", queueName, time.Now(), &err)
+
+	_, err = p.db.Exec(ctx, fmt.Sprintf(`SELECT %s.create(queue_name => $1);`, p.schema), queueName)
+	return err
+}
+
+func (p *PgxQueueDriver) CreateUnloggedQueue(ctx context.Context, queueName string) (err error) {
+	defer logOperation(p.logger.current(), "create_unlogged", queueName, time.Now(), &err)
+
+	_, err = p.db.Exec(ctx, fmt.Sprintf(`SELECT %s.create_unlogged(queue_name => $1);`, p.schema), queueName)
+	return err
+}
+
+func (p *PgxQueueDriver) CreatePartitionedQueue(ctx context.Context, queueName string, partitionInterval string, retentionInterval string) (err error) {
+	defer logOperation(p.logger.current(), "create_partitioned", queueName, time.Now(), &err)
+
+	_, err = p.db.Exec(ctx, fmt.Sprintf(`SELECT %s.create_partitioned(
+		queue_name         => $1,
+		partition_interval => $2,
+		retention_interval => $3
+	);`, p.schema), queueName, partitionInterval, retentionInterval)
+	return err
+}
+
+func (p *PgxQueueDriver) DropQueue(ctx context.Context, queueName string) (dropped bool, err error) {
+	defer logOperation(p.logger.current(), "drop_queue", queueName, time.Now(), &err)
+
+	err = p.db.QueryRow(ctx, fmt.Sprintf(`SELECT %s.drop_queue(queue_name => $1);`, p.schema), queueName).Scan(&dropped)
+	return dropped, err
+}
+
+func (p *PgxQueueDriver) PurgeQueue(ctx context.Context, queueName string) (purged int64, err error) {
+	defer logOperation(p.logger.current(), "purge_queue", queueName, time.Now(), &err)
+
+	err = p.db.QueryRow(ctx, fmt.Sprintf(`SELECT %s.purge_queue(queue_name => $1);`, p.schema), queueName).Scan(&purged)
+	return purged, err
+}
+
+func (p *PgxQueueDriver) ListQueues(ctx context.Context) (queues []consumer.QueueInfo, err error) {
+	defer logOperation(p.logger.current(), "list_queues", "", time.Now(), &err)
+
+	rows, err := p.db.Query(ctx, fmt.Sprintf(`SELECT * FROM %s.list_queues();`, p.schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := pgxColumns(rows)
+	for rows.Next() {
+		var queue consumer.QueueInfo
+		if err := rows.Scan(queueInfoDestinations(&queue, columns)...); err != nil {
+			return nil, err
+		}
+		queues = append(queues, queue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return queues, nil
+}
+
+func (p *PgxQueueDriver) Metrics(ctx context.Context, queueName string) (metrics consumer.QueueMetrics, err error) {
+	defer logOperation(p.logger.current(), "metrics", queueName, time.Now(), &err)
+
+	rows, err := p.db.Query(ctx, fmt.Sprintf(`SELECT * FROM %s.metrics(queue_name => $1);`, p.schema), queueName)
+	if err != nil {
+		return metrics, err
+	}
+	defer rows.Close()
+
+	columns := pgxColumns(rows)
+	if rows.Next() {
+		if err := rows.Scan(queueMetricsDestinations(&metrics, columns)...); err != nil {
+			return metrics, err
+		}
+	}
+	return metrics, rows.Err()
+}
+
+func pgxColumns(rows pgx.Rows) []string {
+	columns := make([]string, 0, len(rows.FieldDescriptions()))
+	for _, field := range rows.FieldDescriptions() {
+		columns = append(columns, field.Name)
+	}
+	return columns
+}
+
+// queueInfoDestinations and queueMetricsDestinations read the columns by
+// name, so the columns added by newer pgmq versions are ignored.
+func queueInfoDestinations(queue *consumer.QueueInfo, columns []string) []any {
+	destinations := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "queue_name":
+			destinations[i] = &queue.QueueName
+		case "is_partitioned":
+			destinations[i] = &queue.IsPartitioned
+		case "is_unlogged":
+			destinations[i] = &queue.IsUnlogged
+		case "created_at":
+			destinations[i] = &queue.CreatedAt
+		default:
+			destinations[i] = new(any)
+		}
+	}
+	return destinations
+}
+
+func queueMetricsDestinations(metrics *consumer.QueueMetrics, columns []string) []any {
+	destinations := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "queue_name":
+			destinations[i] = &metrics.QueueName
+		case "queue_length":
+			destinations[i] = &metrics.QueueLength
+		case "queue_visible_length":
+			destinations[i] = &metrics.QueueVisibleLength
+		case "newest_msg_age_sec":
+			destinations[i] = &metrics.NewestMsgAgeSec
+		case "oldest_msg_age_sec":
+			destinations[i] = &metrics.OldestMsgAgeSec
+		case "total_messages":
+			destinations[i] = &metrics.TotalMessages
+		case "scrape_time":
+			destinations[i] = &metrics.ScrapeTime
+		default:
+			destinations[i] = new(any)
+		}
+	}
+	return destinations
+}
@@ -4,86 +4,165 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/tiago123456789/consumer-pgmq-go/consumer"
 )
 
+// DBTX is satisfied by *sql.DB, *sql.Tx and *sql.Conn.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type PostgresQueueDriver struct {
-	db     *sql.DB
-	schema string
+	db      DBTX
+	schema  string
+	logger  *driverLogger
+	headers *headersSupport
 }
 
 func NewPostgresQueueDriver(db *sql.DB, schema string) *PostgresQueueDriver {
 	if schema == "" {
 		schema = "pgmq"
 	}
-	return &PostgresQueueDriver{db: db, schema: schema}
+	return &PostgresQueueDriver{
+		db:      db,
+		schema:  schema,
+		logger:  &driverLogger{},
+		headers: &headersSupport{},
+	}
+}
+
+// WithTx returns a driver running the operations in tx, for example to send
+// a message in the same transaction of the writes of your service
+// (transactional outbox). tx can be a *sql.Tx, *sql.Conn or *sql.DB.
+func (p *PostgresQueueDriver) WithTx(tx DBTX) *PostgresQueueDriver {
+	return &PostgresQueueDriver{
+		db:      tx,
+		schema:  p.schema,
+		logger:  p.logger,
+		headers: p.headers,
+	}
+}
+
+func (p *PostgresQueueDriver) SetLogger(logger *slog.Logger) {
+	p.logger.set(logger)
+}
+
+// SetDefaultLogger sets the logger only if SetLogger was not called.
+func (p *PostgresQueueDriver) SetDefaultLogger(logger *slog.Logger) {
+	p.logger.setDefault(logger)
 }
 
-func (p *PostgresQueueDriver) Get(queueName string, visibilityTime int, totalMessages int) ([]consumer.Message, error) {
-	sqlStatement, err := p.db.Query(fmt.Sprintf(`SELECT msg_id, read_ct, enqueued_at, vt, message FROM %s.read(
-		queue_name => $1,
-		vt         => $2,
-		qty        => $3
-	);`, p.schema), queueName, visibilityTime, totalMessages)
+func (p *PostgresQueueDriver) Get(queueName string, visibilityTime int, totalMessages int) (result []consumer.Message, err error) {
+	defer logOperation(p.logger.current(), "read", queueName, time.Now(), &err)
+
+	sqlStatement, err := p.db.QueryContext(context.Background(), readQuery(p.schema), queueName, visibilityTime, totalMessages)
 	if err != nil {
 		return nil, err
 	}
 	defer sqlStatement.Close()
 
-	var messages []consumer.Message
-	for sqlStatement.Next() {
+	return scanMessages(sqlStatement)
+}
 
-		var message consumer.Message
-		var messageBody []byte
+// ReadWithPoll waits on the server up to maxPollSeconds for messages,
+// checking the queue every pollIntervalMs. Cancelling ctx cancels the query,
+// so the messages are not read.
+func (p *PostgresQueueDriver) ReadWithPoll(
+	ctx context.Context,
+	queueName string,
+	visibilityTime int,
+	totalMessages int,
+	maxPollSeconds int,
+	pollIntervalMs int,
+) (result []consumer.Message, err error) {
+	defer logOperation(p.logger.current(), "read_with_poll", queueName, time.Now(), &err)
 
-		err = sqlStatement.Scan(&message.MsgID, &message.ReadCT, &message.EnqueuedAt, &message.VT, &messageBody)
-		if err != nil {
-			return nil, err
-		}
+	sqlStatement, err := p.db.QueryContext(ctx, readWithPollQuery(p.schema), queueName, visibilityTime, totalMessages, maxPollSeconds, pollIntervalMs)
+	if err != nil {
+		return nil, err
+	}
+	defer sqlStatement.Close()
 
-		json.Unmarshal(messageBody, &message.Message)
+	return scanMessages(sqlStatement)
+}
 
-		messages = append(messages, message)
+func (p *PostgresQueueDriver) Pop(queueName string) (result []consumer.Message, err error) {
+	defer logOperation(p.logger.current(), "pop", queueName, time.Now(), &err)
+
+	sqlStatement, err := p.db.QueryContext(context.Background(), popQuery(p.schema), queueName)
+	if err != nil {
+		return nil, err
 	}
+	defer sqlStatement.Close()
 
-	return messages, nil
+	return scanMessages(sqlStatement)
 }
 
-func (p *PostgresQueueDriver) Pop(queueName string) ([]consumer.Message, error) {
-	sqlStatement, err := p.db.Query(fmt.Sprintf(`SELECT msg_id, read_ct, enqueued_at, vt, message FROM %s.pop(
-		queue_name => $1
-	);`, p.schema), queueName)
+// scanMessages reads the columns by name, so the headers column is read
+// when the installed pgmq version has it.
+func scanMessages(rows *sql.Rows) ([]consumer.Message, error) {
+	columns, err := rows.Columns()
 	if err != nil {
 		return nil, err
 	}
-	defer sqlStatement.Close()
 
 	var messages []consumer.Message
-	for sqlStatement.Next() {
-
+	for rows.Next() {
 		var message consumer.Message
 		var messageBody []byte
+		var headers []byte
 
-		err = sqlStatement.Scan(&message.MsgID, &message.ReadCT, &message.EnqueuedAt, &message.VT, &messageBody)
-		if err != nil {
-			panic(err.Error())
+		destinations := make([]interface{}, len(columns))
+		for i, column := range columns {
+			switch column {
+			case "msg_id":
+				destinations[i] = &message.MsgID
+			case "read_ct":
+				destinations[i] = &message.ReadCT
+			case "enqueued_at":
+				destinations[i] = &message.EnqueuedAt
+			case "vt":
+				destinations[i] = &message.VT
+			case "message":
+				destinations[i] = &messageBody
+			case "headers":
+				destinations[i] = &headers
+			default:
+				destinations[i] = new(interface{})
+			}
 		}
 
+		if err := rows.Scan(destinations...); err != nil {
+			return nil, err
+		}
+
+		message.Raw = messageBody
 		json.Unmarshal(messageBody, &message.Message)
+		if len(headers) > 0 {
+			json.Unmarshal(headers, &message.Headers)
+		}
 
 		messages = append(messages, message)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return messages, nil
 }
 
-func (p *PostgresQueueDriver) Delete(queueName string, msgID int64) error {
-	_, err := p.db.Exec(fmt.Sprintf(` SELECT * FROM %s.delete(
-	            queue_name => $1,
-	            msg_id     => $2
-	        );`, p.schema), queueName, msgID)
+func (p *PostgresQueueDriver) Delete(queueName string, msgID int64) (err error) {
+	defer logOperation(p.logger.current(), "delete", queueName, time.Now(), &err, "msg_id", msgID)
+
+	_, err = p.db.ExecContext(context.Background(), completeQuery(p.schema, "delete", false), queueName, msgID)
 	if err != nil {
 		return err
 	}
@@ -92,19 +171,223 @@ func (p *PostgresQueueDriver) Delete(queueName string, msgID int64) error {
 }
 
 func (p *PostgresQueueDriver) Send(queueName string, message map[string]interface{}, signal context.Context,
-) error {
+) (err error) {
+	defer logOperation(p.logger.current(), "send", queueName, time.Now(), &err)
+
+	jsonMessage, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(signal, sendQuery(p.schema, false), queueName, jsonMessage, 0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SupportsHeaders checks once if the installed pgmq version has the
+// headers column, added in pgmq 1.5.
+func (p *PostgresQueueDriver) SupportsHeaders(signal context.Context) (bool, error) {
+	return p.headers.check(p.logger.current(), func() (supported bool, err error) {
+		err = p.db.QueryRowContext(signal, supportsHeadersQuery, p.schema).Scan(&supported)
+		return supported, err
+	})
+}
+
+// SendWithHeaders sends the message without the headers when the installed
+// pgmq version doesn't support them.
+func (p *PostgresQueueDriver) SendWithHeaders(queueName string, message map[string]interface{}, headers map[string]interface{}, signal context.Context,
+) (err error) {
+	supported, err := p.SupportsHeaders(signal)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return p.Send(queueName, message, signal)
+	}
+
+	defer logOperation(p.logger.current(), "send", queueName, time.Now(), &err)
+
 	jsonMessage, err := json.Marshal(message)
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+	jsonHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(signal, sendQuery(p.schema, true), queueName, jsonMessage, jsonHeaders, 0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresQueueDriver) SetVisibilityTime(queueName string, msgID int64, visibilityTime int) (err error) {
+	defer logOperation(p.logger.current(), "set_vt", queueName, time.Now(), &err, "msg_id", msgID)
+
+	_, err = p.db.ExecContext(context.Background(), setVisibilityTimeQuery(p.schema), queueName, msgID, visibilityTime)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresQueueDriver) DeleteBatch(queueName string, msgIDs []int64) (err error) {
+	defer logOperation(p.logger.current(), "delete_batch", queueName, time.Now(), &err)
+
+	_, err = p.db.ExecContext(context.Background(), completeQuery(p.schema, "delete", true), queueName, pq.Array(msgIDs))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresQueueDriver) ArchiveBatch(queueName string, msgIDs []int64) (err error) {
+	defer logOperation(p.logger.current(), "archive_batch", queueName, time.Now(), &err)
+
+	_, err = p.db.ExecContext(context.Background(), completeQuery(p.schema, "archive", true), queueName, pq.Array(msgIDs))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresQueueDriver) SendBatch(queueName string, messages []map[string]interface{}, signal context.Context,
+) (err error) {
+	defer logOperation(p.logger.current(), "send_batch", queueName, time.Now(), &err)
+
+	jsonMessages := make([]string, 0, len(messages))
+	for _, message := range messages {
+		jsonMessage, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		jsonMessages = append(jsonMessages, string(jsonMessage))
+	}
+
+	_, err = p.db.ExecContext(signal, sendBatchQuery(p.schema, false), queueName, pq.Array(jsonMessages), 0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendMessages sends the messages with send_batch, visible after
+// delaySeconds, and returns their ids.
+func (p *PostgresQueueDriver) SendMessages(queueName string, messages []json.RawMessage, headers []map[string]interface{}, delaySeconds int, signal context.Context,
+) (msgIDs []int64, err error) {
+	defer logOperation(p.logger.current(), "send_batch", queueName, time.Now(), &err)
+
+	jsonMessages := make([]string, 0, len(messages))
+	for _, message := range messages {
+		jsonMessages = append(jsonMessages, string(message))
+	}
+
+	var rows *sql.Rows
+	supported := false
+	if headers != nil {
+		supported, err = p.SupportsHeaders(signal)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if supported {
+		jsonHeaders := make([]string, 0, len(headers))
+		for _, header := range headers {
+			jsonHeader, err := json.Marshal(header)
+			if err != nil {
+				return nil, err
+			}
+			jsonHeaders = append(jsonHeaders, string(jsonHeader))
+		}
+
+		rows, err = p.db.QueryContext(signal, sendBatchQuery(p.schema, true), queueName, pq.Array(jsonMessages), pq.Array(jsonHeaders), delaySeconds)
+	} else {
+		rows, err = p.db.QueryContext(signal, sendBatchQuery(p.schema, false), queueName, pq.Array(jsonMessages), delaySeconds)
+	}
+	if err != nil {
+		return nil, err
 	}
-	_, err = p.db.Exec(fmt.Sprintf(` SELECT * FROM %s.send(
-	            queue_name => $1,
-	            msg        => $2,
-	            delay      => $3
-	        );`, p.schema), queueName, jsonMessage, 0)
+	defer rows.Close()
+
+	for rows.Next() {
+		var msgID int64
+		if err := rows.Scan(&msgID); err != nil {
+			return nil, err
+		}
+		msgIDs = append(msgIDs, msgID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return msgIDs, nil
+}
+
+func (p *PostgresQueueDriver) Archive(queueName string, msgID int64) (err error) {
+	defer logOperation(p.logger.current(), "archive", queueName, time.Now(), &err, "msg_id", msgID)
+
+	_, err = p.db.ExecContext(context.Background(), completeQuery(p.schema, "archive", false), queueName, msgID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// PostgresTransaction is the transaction started by the consumer when the
+// option Transactional is set. The handler gets it with TxFromContext.
+type PostgresTransaction struct {
+	*PostgresQueueDriver
+	tx *sql.Tx
+}
+
+func (p *PostgresQueueDriver) BeginTransaction(ctx context.Context) (consumer.Transaction, error) {
+	beginner, ok := p.db.(interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	})
+	if !ok {
+		return nil, errors.New("driver created with WithTx cannot begin a transaction")
+	}
+
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresTransaction{PostgresQueueDriver: p.WithTx(tx), tx: tx}, nil
+}
+
+func (t *PostgresTransaction) Tx() *sql.Tx {
+	return t.tx
+}
+
+func (t *PostgresTransaction) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *PostgresTransaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// TxFromContext returns the transaction of the message handled by a consumer
+// with the option Transactional, or nil.
+func TxFromContext(ctx context.Context) *sql.Tx {
+	tx, ok := consumer.TransactionFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	postgresTransaction, ok := tx.(*PostgresTransaction)
+	if !ok {
+		return nil
+	}
+	return postgresTransaction.tx
+}
@@ -0,0 +1,67 @@
+package queuedriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+// ErrMessageNotFound is returned when the message completed in a transaction
+// was already deleted or archived, usually by another consumer that read it
+// after the visibility time expired. The transaction is rolled back, so the
+// writes of the handler are not duplicated.
+var ErrMessageNotFound = errors.New("message not found")
+
+// TxHandler receives the transaction used to delete or archive the message,
+// its writes are committed only with the message removed from the queue.
+type TxHandler func(ctx context.Context, tx *sql.Tx, msg consumer.Message) error
+
+// NewTxConsumer creates a consumer that begins a transaction for each
+// message, calls the handler with it, deletes or archives the message in
+// the same transaction and commits.
+func NewTxConsumer(
+	handler TxHandler,
+	options consumer.ConsumerOptions,
+	queueDriver *PostgresQueueDriver,
+) (*consumer.Consumer, error) {
+	options.Transactional = true
+	return consumer.NewConsumerWithHandler(func(ctx context.Context, msg consumer.Message) error {
+		tx := TxFromContext(ctx)
+		if tx == nil {
+			return errors.New("transaction of the message not found")
+		}
+		return handler(ctx, tx, msg)
+	}, options, queueDriver)
+}
+
+func (t *PostgresTransaction) Delete(queueName string, msgID int64) (err error) {
+	defer logOperation(t.logger.current(), "delete", queueName, time.Now(), &err, "msg_id", msgID)
+
+	return t.complete("delete", queueName, msgID)
+}
+
+func (t *PostgresTransaction) Archive(queueName string, msgID int64) (err error) {
+	defer logOperation(t.logger.current(), "archive", queueName, time.Now(), &err, "msg_id", msgID)
+
+	return t.complete("archive", queueName, msgID)
+}
+
+func (t *PostgresTransaction) complete(function string, queueName string, msgID int64) error {
+	var completed bool
+	err := t.tx.QueryRowContext(context.Background(), fmt.Sprintf(`SELECT * FROM %s.%s(
+		queue_name => $1,
+		msg_id     => $2
+	);`, t.schema, function), queueName, msgID).Scan(&completed)
+	if err != nil {
+		return err
+	}
+
+	if !completed {
+		return ErrMessageNotFound
+	}
+	return nil
+}
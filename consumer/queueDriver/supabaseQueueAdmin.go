@@ -0,0 +1,99 @@
+package queuedriver
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+// The schema pgmq_public doesn't expose the administration functions, so
+// create the functions create(queue_name), create_unlogged(queue_name),
+// create_partitioned(queue_name, partition_interval, retention_interval),
+// drop_queue(queue_name), purge_queue(queue_name), list_queues() and
+// metrics(queue_name) calling pgmq in the schema used by the Supabase client.
+// The supabase client can't cancel the requests, so ctx is not used.
+
+func (s *SupabaseQueueDriver) CreateQueueContext(ctx context.Context, queueName string) (err error) {
+	defer logOperation(s.logger.current(), "create", queueName, time.Now(), &err)
+
+	err = s.rpcVoid("create", map[string]interface{}{
+		"queue_name": queueName,
+	})
+	return err
+}
+
+func (s *SupabaseQueueDriver) CreateUnloggedQueue(ctx context.Context, queueName string) (err error) {
+	defer logOperation(s.logger.current(), "create_unlogged", queueName, time.Now(), &err)
+
+	err = s.rpcVoid("create_unlogged", map[string]interface{}{
+		"queue_name": queueName,
+	})
+	return err
+}
+
+func (s *SupabaseQueueDriver) CreatePartitionedQueue(ctx context.Context, queueName string, partitionInterval string, retentionInterval string) (err error) {
+	defer logOperation(s.logger.current(), "create_partitioned", queueName, time.Now(), &err)
+
+	err = s.rpcVoid("create_partitioned", map[string]interface{}{
+		"queue_name":         queueName,
+		"partition_interval": partitionInterval,
+		"retention_interval": retentionInterval,
+	})
+	return err
+}
+
+func (s *SupabaseQueueDriver) DropQueue(ctx context.Context, queueName string) (dropped bool, err error) {
+	defer logOperation(s.logger.current(), "drop_queue", queueName, time.Now(), &err)
+
+	result, err := s.rpc("drop_queue", map[string]interface{}{
+		"queue_name": queueName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal([]byte(result), &dropped)
+	return dropped, err
+}
+
+func (s *SupabaseQueueDriver) PurgeQueue(ctx context.Context, queueName string) (purged int64, err error) {
+	defer logOperation(s.logger.current(), "purge_queue", queueName, time.Now(), &err)
+
+	result, err := s.rpc("purge_queue", map[string]interface{}{
+		"queue_name": queueName,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = json.Unmarshal([]byte(result), &purged)
+	return purged, err
+}
+
+func (s *SupabaseQueueDriver) ListQueues(ctx context.Context) (queues []consumer.QueueInfo, err error) {
+	defer logOperation(s.logger.current(), "list_queues", "", time.Now(), &err)
+
+	result, err := s.rpc("list_queues", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(result), &queues)
+	return queues, err
+}
+
+func (s *SupabaseQueueDriver) Metrics(ctx context.Context, queueName string) (metrics consumer.QueueMetrics, err error) {
+	defer logOperation(s.logger.current(), "metrics", queueName, time.Now(), &err)
+
+	result, err := s.rpc("metrics", map[string]interface{}{
+		"queue_name": queueName,
+	})
+	if err != nil {
+		return metrics, err
+	}
+
+	err = json.Unmarshal([]byte(result), &metrics)
+	return metrics, err
+}
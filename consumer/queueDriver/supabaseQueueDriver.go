@@ -3,50 +3,202 @@ package queuedriver
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/supabase-community/supabase-go"
 	"github.com/tiago123456789/consumer-pgmq-go/consumer"
 )
 
+// POSTGREST_FUNCTION_NOT_FOUND is returned by PostgREST when no function
+// matches the name and the parameters of the rpc.
+const POSTGREST_FUNCTION_NOT_FOUND = "PGRST202"
+
 type SupabaseQueueDriver struct {
 	client *supabase.Client
+	logger *driverLogger
+
+	headersUnsupported atomic.Bool
+	setVtUnsupported   atomic.Bool
+}
+
+type supabaseError struct {
+	Function string `json:"-"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Details  string `json:"details"`
+	Hint     string `json:"hint"`
+}
+
+func (e *supabaseError) Error() string {
+	return fmt.Sprintf("rpc %s failed: %s %s", e.Function, e.Code, e.Message)
 }
 
 func NewSupabaseQueueDriver(client *supabase.Client) *SupabaseQueueDriver {
 	return &SupabaseQueueDriver{
 		client: client,
+		logger: &driverLogger{},
 	}
 }
 
+func (s *SupabaseQueueDriver) SetLogger(logger *slog.Logger) {
+	s.logger.set(logger)
+}
+
+// SetDefaultLogger sets the logger only if SetLogger was not called.
+func (s *SupabaseQueueDriver) SetDefaultLogger(logger *slog.Logger) {
+	s.logger.setDefault(logger)
+}
+
+// rpc calls the function and returns the response body. The supabase client
+// hides the request errors and returns an empty body, and PostgREST returns
+// the errors as a json object with code and message.
+func (s *SupabaseQueueDriver) rpc(name string, body map[string]interface{}) (string, error) {
+	result := s.client.Rpc(name, "", body)
+	if result == "" {
+		return "", fmt.Errorf("rpc %s returned empty response", name)
+	}
+
+	if err := rpcError(name, result); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// rpcVoid calls a function returning void, like pgmq create. PostgREST
+// answers it with an empty body, so only a PostgREST error object is an
+// error, the request errors hidden by the supabase client are not detected.
+func (s *SupabaseQueueDriver) rpcVoid(name string, body map[string]interface{}) error {
+	return rpcError(name, s.client.Rpc(name, "", body))
+}
+
+func rpcError(name string, result string) error {
+	if !strings.HasPrefix(strings.TrimSpace(result), "{") {
+		return nil
+	}
+
+	var rpcError supabaseError
+	if err := json.Unmarshal([]byte(result), &rpcError); err == nil && rpcError.Message != "" {
+		rpcError.Function = name
+		return &rpcError
+	}
+	return nil
+}
+
 func (s *SupabaseQueueDriver) Send(
 	queueName string,
 	message map[string]interface{},
 	signal context.Context,
-) error {
-	s.client.Rpc("send", "", map[string]interface{}{
+) (err error) {
+	defer logOperation(s.logger.current(), "send", queueName, time.Now(), &err)
+
+	_, err = s.rpc("send", map[string]interface{}{
 		"queue_name": queueName,
 		"message":    message,
 	})
-	return nil
+	return err
+}
+
+// SendWithHeaders calls send with the parameter headers. The send of
+// pgmq_public has no headers, so create a function send(queue_name,
+// message, headers) in the schema used by the Supabase client, otherwise the
+// message is sent without the headers.
+func (s *SupabaseQueueDriver) SendWithHeaders(
+	queueName string,
+	message map[string]interface{},
+	headers map[string]interface{},
+	signal context.Context,
+) (err error) {
+	if s.headersUnsupported.Load() {
+		return s.Send(queueName, message, signal)
+	}
+
+	defer logOperation(s.logger.current(), "send", queueName, time.Now(), &err)
+
+	_, err = s.rpc("send", map[string]interface{}{
+		"queue_name": queueName,
+		"message":    message,
+		"headers":    headers,
+	})
+
+	var rpcError *supabaseError
+	if errors.As(err, &rpcError) && rpcError.Code == POSTGREST_FUNCTION_NOT_FOUND {
+		s.logger.current().Warn("function send with headers not found, headers are discarded")
+		s.headersUnsupported.Store(true)
+		return s.Send(queueName, message, signal)
+	}
+	return err
 }
 
 func (s *SupabaseQueueDriver) Get(
 	queueName string,
 	visibilityTime int,
 	totalMessages int,
-) ([]consumer.Message, error) {
-	result := s.client.Rpc("read", "", map[string]interface{}{
+) (messages []consumer.Message, err error) {
+	defer logOperation(s.logger.current(), "read", queueName, time.Now(), &err)
+
+	result, err := s.rpc("read", map[string]interface{}{
 		"queue_name":    queueName,
 		"sleep_seconds": visibilityTime,
 		"n":             totalMessages,
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	if result == "" {
-		return nil, nil
+	err = json.Unmarshal([]byte(result), &messages)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ReadWithPoll calls read_with_poll, pgmq_public doesn't expose it, so
+// create a function read_with_poll(queue_name, vt, qty, max_poll_seconds,
+// poll_interval_ms) in the schema used by the Supabase client. The supabase
+// client can't cancel the request, so when ctx is cancelled the response is
+// discarded and the messages read are visible again after the visibility time.
+func (s *SupabaseQueueDriver) ReadWithPoll(
+	ctx context.Context,
+	queueName string,
+	visibilityTime int,
+	totalMessages int,
+	maxPollSeconds int,
+	pollIntervalMs int,
+) (messages []consumer.Message, err error) {
+	defer logOperation(s.logger.current(), "read_with_poll", queueName, time.Now(), &err)
+
+	type response struct {
+		result string
+		err    error
 	}
+	responses := make(chan response, 1)
+	go func() {
+		result, err := s.rpc("read_with_poll", map[string]interface{}{
+			"queue_name":       queueName,
+			"vt":               visibilityTime,
+			"qty":              totalMessages,
+			"max_poll_seconds": maxPollSeconds,
+			"poll_interval_ms": pollIntervalMs,
+		})
+		responses <- response{result: result, err: err}
+	}()
 
-	var messages []consumer.Message
-	err := json.Unmarshal([]byte(result), &messages)
+	var res response
+	select {
+	case res = <-responses:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	err = json.Unmarshal([]byte(res.result), &messages)
 	if err != nil {
 		return nil, err
 	}
@@ -55,13 +207,17 @@ func (s *SupabaseQueueDriver) Get(
 
 func (s *SupabaseQueueDriver) Pop(
 	queueName string,
-) ([]consumer.Message, error) {
-	result := s.client.Rpc("pop", "", map[string]interface{}{
+) (messages []consumer.Message, err error) {
+	defer logOperation(s.logger.current(), "pop", queueName, time.Now(), &err)
+
+	result, err := s.rpc("pop", map[string]interface{}{
 		"queue_name": queueName,
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	var messages []consumer.Message
-	err := json.Unmarshal([]byte(result), &messages)
+	err = json.Unmarshal([]byte(result), &messages)
 	if err != nil {
 		return nil, err
 	}
@@ -72,10 +228,113 @@ func (s *SupabaseQueueDriver) Pop(
 func (s *SupabaseQueueDriver) Delete(
 	queueName string,
 	messageID int64,
-) error {
-	s.client.Rpc("delete", "", map[string]interface{}{
+) (err error) {
+	defer logOperation(s.logger.current(), "delete", queueName, time.Now(), &err, "msg_id", messageID)
+
+	_, err = s.rpc("delete", map[string]interface{}{
 		"queue_name": queueName,
 		"message_id": messageID,
 	})
-	return nil
+	return err
+}
+
+func (s *SupabaseQueueDriver) Archive(
+	queueName string,
+	messageID int64,
+) (err error) {
+	defer logOperation(s.logger.current(), "archive", queueName, time.Now(), &err, "msg_id", messageID)
+
+	_, err = s.rpc("archive", map[string]interface{}{
+		"queue_name": queueName,
+		"message_id": messageID,
+	})
+	return err
+}
+
+// SetVisibilityTime calls set_vt, which pgmq_public doesn't expose, so create
+// the function set_vt(queue_name, message_id, vt) in the schema used by the
+// Supabase client. Without it consumer.ErrOperationNotSupported is returned
+// and the message is visible again only after the visibility time.
+func (s *SupabaseQueueDriver) SetVisibilityTime(
+	queueName string,
+	messageID int64,
+	visibilityTime int,
+) (err error) {
+	if s.setVtUnsupported.Load() {
+		return consumer.ErrOperationNotSupported
+	}
+
+	defer logOperation(s.logger.current(), "set_vt", queueName, time.Now(), &err, "msg_id", messageID)
+
+	_, err = s.rpc("set_vt", map[string]interface{}{
+		"queue_name": queueName,
+		"message_id": messageID,
+		"vt":         visibilityTime,
+	})
+
+	var rpcError *supabaseError
+	if errors.As(err, &rpcError) && rpcError.Code == POSTGREST_FUNCTION_NOT_FOUND {
+		s.logger.current().Warn("function set_vt not found, the retry policy is ignored")
+		s.setVtUnsupported.Store(true)
+		return consumer.ErrOperationNotSupported
+	}
+	return err
+}
+
+func (s *SupabaseQueueDriver) SendBatch(
+	queueName string,
+	messages []map[string]interface{},
+	signal context.Context,
+) (err error) {
+	defer logOperation(s.logger.current(), "send_batch", queueName, time.Now(), &err)
+
+	_, err = s.rpc("send_batch", map[string]interface{}{
+		"queue_name": queueName,
+		"messages":   messages,
+	})
+	return err
+}
+
+// SendMessages calls send_batch and returns the ids of the messages. The
+// headers are sent only if the function send_batch(queue_name, messages,
+// headers, sleep_seconds) exists in the schema used by the Supabase client.
+func (s *SupabaseQueueDriver) SendMessages(
+	queueName string,
+	messages []json.RawMessage,
+	headers []map[string]interface{},
+	delaySeconds int,
+	signal context.Context,
+) (msgIDs []int64, err error) {
+	defer logOperation(s.logger.current(), "send_batch", queueName, time.Now(), &err)
+
+	body := map[string]interface{}{
+		"queue_name":    queueName,
+		"messages":      messages,
+		"sleep_seconds": delaySeconds,
+	}
+
+	var result string
+	if headers != nil && !s.headersUnsupported.Load() {
+		body["headers"] = headers
+		result, err = s.rpc("send_batch", body)
+
+		var rpcError *supabaseError
+		if errors.As(err, &rpcError) && rpcError.Code == POSTGREST_FUNCTION_NOT_FOUND {
+			s.logger.current().Warn("function send_batch with headers not found, headers are discarded")
+			s.headersUnsupported.Store(true)
+			delete(body, "headers")
+			result, err = s.rpc("send_batch", body)
+		}
+	} else {
+		result, err = s.rpc("send_batch", body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(result), &msgIDs)
+	if err != nil {
+		return nil, err
+	}
+	return msgIDs, nil
 }
@@ -0,0 +1,202 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const DEFAULT_REDRIVE_BATCH_SIZE = 10
+const DEFAULT_REDRIVE_VISIBILITY_TIME = 30
+
+type RedriveOptions struct {
+	// MaxCount is the max of messages redriven, 0 means all.
+	MaxCount int
+	// OlderThan and NewerThan filter by the time the message was enqueued
+	// in the source queue, 0 means no filter.
+	OlderThan time.Duration
+	NewerThan time.Duration
+	Predicate func(msg Message) bool
+	// RatePerSecond limits the messages redriven by second, 0 means no limit.
+	RatePerSecond int
+	// DryRun only counts the messages matching the filters.
+	DryRun bool
+	// KeepEnvelope sends the dlq envelope as is instead of the original body.
+	KeepEnvelope   bool
+	BatchSize      int
+	VisibilityTime int
+}
+
+type RedriveResult struct {
+	Redriven int
+	Skipped  int
+	// Failed counts the messages whose body is not a json object and the
+	// queue driver can't send them, they are kept in the source queue.
+	Failed int
+}
+
+// Redrive moves the messages from one queue to another, usually from the
+// dlq back to the main queue after the bug that caused the failures is
+// fixed. Messages skipped by the filters, or all of them in dry run, are
+// made visible again in the source queue when the redrive finishes, and the
+// redrive finishes when one of them is read again after its visibility time.
+func Redrive(
+	ctx context.Context,
+	queueDriver QueueDriver,
+	from string,
+	to string,
+	options RedriveOptions,
+) (result RedriveResult, err error) {
+	if from == "" || to == "" {
+		return RedriveResult{}, errors.New("source and destination queues must be set")
+	}
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DEFAULT_REDRIVE_BATCH_SIZE
+	}
+	visibilityTime := options.VisibilityTime
+	if visibilityTime <= 0 {
+		visibilityTime = DEFAULT_REDRIVE_VISIBILITY_TIME
+	}
+
+	var ticker *time.Ticker
+	if options.RatePerSecond > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(options.RatePerSecond))
+		defer ticker.Stop()
+	}
+
+	var untouched []int64
+	defer func() {
+		for _, msgID := range untouched {
+			if resetErr := queueDriver.SetVisibilityTime(from, msgID, 0); resetErr != nil {
+				err = errors.Join(err, resetErr)
+			}
+		}
+	}()
+
+	seen := make(map[int64]bool)
+
+	for options.MaxCount <= 0 || result.Redriven < options.MaxCount {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		quantity := batchSize
+		if options.MaxCount > 0 && options.MaxCount-result.Redriven < quantity {
+			quantity = options.MaxCount - result.Redriven
+		}
+
+		messages, err := queueDriver.Get(from, visibilityTime, quantity)
+		if err != nil {
+			return result, err
+		}
+		if len(messages) == 0 {
+			return result, nil
+		}
+
+		finished := false
+		for _, msg := range messages {
+			if seen[msg.MsgID] {
+				finished = true
+				continue
+			}
+			seen[msg.MsgID] = true
+
+			if !matchesRedrive(msg, options) {
+				result.Skipped++
+				untouched = append(untouched, msg.MsgID)
+				continue
+			}
+
+			if ticker != nil {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					untouched = append(untouched, msg.MsgID)
+					return result, ctx.Err()
+				}
+			}
+
+			if options.DryRun {
+				result.Redriven++
+				untouched = append(untouched, msg.MsgID)
+				continue
+			}
+
+			body, raw := redriveBody(msg, options.KeepEnvelope)
+			if raw != nil {
+				rawSender, ok := queueDriver.(RawSender)
+				if !ok {
+					result.Failed++
+					untouched = append(untouched, msg.MsgID)
+					continue
+				}
+
+				var headers []map[string]interface{}
+				if len(msg.Headers) > 0 {
+					headers = []map[string]interface{}{msg.Headers}
+				}
+				if _, err := rawSender.SendMessages(to, []json.RawMessage{raw}, headers, 0, ctx); err != nil {
+					untouched = append(untouched, msg.MsgID)
+					return result, err
+				}
+			} else if err := sendWithHeaders(queueDriver, to, body, msg.Headers, ctx); err != nil {
+				untouched = append(untouched, msg.MsgID)
+				return result, err
+			}
+			if err := queueDriver.Delete(from, msg.MsgID); err != nil {
+				return result, err
+			}
+			result.Redriven++
+		}
+
+		if finished {
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+func matchesRedrive(msg Message, options RedriveOptions) bool {
+	if options.OlderThan > 0 || options.NewerThan > 0 {
+		enqueuedAt, err := time.Parse(time.RFC3339Nano, msg.EnqueuedAt)
+		if err != nil {
+			return false
+		}
+
+		age := time.Since(enqueuedAt)
+		if options.OlderThan > 0 && age < options.OlderThan {
+			return false
+		}
+		if options.NewerThan > 0 && age > options.NewerThan {
+			return false
+		}
+	}
+
+	if options.Predicate != nil && !options.Predicate(msg) {
+		return false
+	}
+
+	return true
+}
+
+// redriveBody returns the body to send, or nil and the raw body when it is
+// not a json object, like a string sent to the dlq after a decode error.
+func redriveBody(msg Message, keepEnvelope bool) (map[string]interface{}, json.RawMessage) {
+	if !keepEnvelope {
+		if envelope, ok := ParseDlqEnvelope(msg); ok {
+			if body := envelope.Body(); body != nil {
+				return body, nil
+			}
+			return nil, envelope.Message
+		}
+	}
+
+	if msg.Message == nil && len(msg.Raw) > 0 {
+		return nil, msg.Raw
+	}
+	return msg.Message, nil
+}
@@ -0,0 +1,48 @@
+package consumer
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy returns how long a failed message stays invisible before the
+// next attempt, based on how many times the message was read.
+type RetryPolicy func(readCT int64) time.Duration
+
+func FixedRetryPolicy(delay time.Duration) RetryPolicy {
+	return func(readCT int64) time.Duration {
+		return delay
+	}
+}
+
+func ExponentialRetryPolicy(initialDelay time.Duration, maxDelay time.Duration) RetryPolicy {
+	return func(readCT int64) time.Duration {
+		return exponentialDelay(initialDelay, maxDelay, readCT)
+	}
+}
+
+func ExponentialJitterRetryPolicy(initialDelay time.Duration, maxDelay time.Duration) RetryPolicy {
+	return func(readCT int64) time.Duration {
+		delay := exponentialDelay(initialDelay, maxDelay, readCT)
+		if delay <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int64N(int64(delay) + 1))
+	}
+}
+
+func exponentialDelay(initialDelay time.Duration, maxDelay time.Duration, readCT int64) time.Duration {
+	if readCT < 1 {
+		readCT = 1
+	}
+
+	delay := float64(initialDelay) * math.Pow(2, float64(readCT-1))
+	if maxDelay > 0 && delay > float64(maxDelay) {
+		return maxDelay
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
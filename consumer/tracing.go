@@ -0,0 +1,43 @@
+package consumer
+
+import "context"
+
+// Tracer starts a span for each message handled by the consumer. The package
+// consumer/tracing implements it using OpenTelemetry.
+type Tracer interface {
+	Start(ctx context.Context, queueName string, msg Message) (context.Context, Span)
+}
+
+// Span receives the events of one message: retry, abort-error and
+// send-to-dlq, using the same names of the event listeners.
+type Span interface {
+	AddEvent(name string)
+	RecordError(err error)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, queueName string, msg Message) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) AddEvent(name string)  {}
+func (noopSpan) RecordError(err error) {}
+func (noopSpan) End()                  {}
+
+type spanContextKey struct{}
+
+func (c *Consumer) startSpan(ctx context.Context, msg Message) (context.Context, Span) {
+	ctx, span := c.tracer.Start(ctx, c.options.QueueName, msg)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+func spanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanContextKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
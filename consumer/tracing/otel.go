@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRACER_NAME = "github.com/tiago123456789/consumer-pgmq-go/consumer/tracing"
+
+// Tracer propagates the trace context through the message headers: Send
+// injects it on the producer and Start extracts it to create the span of
+// each message on the consumer. Set it in ConsumerOptions.Tracer.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type TracerOptions struct {
+	// TracerProvider default is the global provider of otel.
+	TracerProvider trace.TracerProvider
+	// Propagator default is the W3C trace context.
+	Propagator propagation.TextMapPropagator
+}
+
+func NewTracer(options TracerOptions) *Tracer {
+	tracerProvider := options.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	propagator := options.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	return &Tracer{
+		tracer:     tracerProvider.Tracer(TRACER_NAME),
+		propagator: propagator,
+	}
+}
+
+// Start creates the consumer span of the message as a child of the trace
+// context found in the message headers.
+func (t *Tracer) Start(ctx context.Context, queueName string, msg consumer.Message) (context.Context, consumer.Span) {
+	ctx = t.Extract(ctx, msg.Headers)
+	ctx, otelSpan := t.tracer.Start(ctx, "process "+queueName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "pgmq"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", queueName),
+			attribute.String("messaging.message.id", strconv.FormatInt(msg.MsgID, 10)),
+			attribute.Int64("messaging.pgmq.read_ct", msg.ReadCT),
+		),
+	)
+	return ctx, span{span: otelSpan}
+}
+
+// Send creates the producer span and sends the message with the trace
+// context injected in the headers.
+func (t *Tracer) Send(
+	ctx context.Context,
+	driver consumer.HeadersSender,
+	queueName string,
+	message map[string]interface{},
+	headers map[string]interface{},
+) error {
+	ctx, otelSpan := t.tracer.Start(ctx, "send "+queueName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "pgmq"),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.destination.name", queueName),
+		),
+	)
+	defer otelSpan.End()
+
+	err := driver.SendWithHeaders(queueName, message, t.Inject(ctx, headers), ctx)
+	if err != nil {
+		span{span: otelSpan}.RecordError(err)
+	}
+	return err
+}
+
+// Inject returns a copy of headers with the trace context of ctx.
+func (t *Tracer) Inject(ctx context.Context, headers map[string]interface{}) map[string]interface{} {
+	carrier := make(headersCarrier, len(headers))
+	for key, value := range headers {
+		carrier[key] = value
+	}
+	t.propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns ctx with the trace context found in headers.
+func (t *Tracer) Extract(ctx context.Context, headers map[string]interface{}) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, headersCarrier(headers))
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) AddEvent(name string) {
+	s.span.AddEvent(name)
+}
+
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+// headersCarrier adapts the message headers to the propagators, only string
+// values are read.
+type headersCarrier map[string]interface{}
+
+func (h headersCarrier) Get(key string) string {
+	value, _ := h[key].(string)
+	return value
+}
+
+func (h headersCarrier) Set(key string, value string) {
+	h[key] = value
+}
+
+func (h headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,65 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+)
+
+// Transaction runs the queue operations in a database transaction.
+type Transaction interface {
+	QueueDriver
+	Commit() error
+	Rollback() error
+}
+
+// TransactionalDriver is implemented by queue drivers able to run the
+// handler and the completion of the message in one transaction, so the
+// writes of the handler and the delete are committed together.
+type TransactionalDriver interface {
+	BeginTransaction(ctx context.Context) (Transaction, error)
+}
+
+type transactionContextKey struct{}
+
+// TransactionFromContext returns the transaction of the message handled
+// when the option Transactional is set.
+func TransactionFromContext(ctx context.Context) (Transaction, bool) {
+	tx, ok := ctx.Value(transactionContextKey{}).(Transaction)
+	return tx, ok
+}
+
+func validateTransactional(options ConsumerOptions, queueDriver QueueDriver) error {
+	if !options.Transactional {
+		return nil
+	}
+	if options.ConsumerType != "read" {
+		return errors.New("Transactional requires ConsumerType 'read'")
+	}
+	if _, ok := queueDriver.(TransactionalDriver); !ok {
+		return errors.New("Transactional requires a queue driver implementing TransactionalDriver")
+	}
+	return nil
+}
+
+func (c *Consumer) beginTransaction(ctx context.Context, msg Message) (context.Context, Transaction, error) {
+	tx, err := c.queueDriver.(TransactionalDriver).BeginTransaction(ctx)
+	if err != nil {
+		c.notifyDriverError(DRIVER_OPERATION_BEGIN, c.options.QueueName, msg, err)
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, transactionContextKey{}, tx), tx, nil
+}
+
+// commitMessage completes the message in the transaction and commits it.
+func (c *Consumer) commitMessage(tx Transaction, msg Message) error {
+	if err := completeMessage(tx, c.options.QueueName, msg.MsgID, c.options.CompletionMode); err != nil {
+		c.notifyDriverError(completionOperation(c.options.CompletionMode), c.options.QueueName, msg, err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.notifyDriverError(DRIVER_OPERATION_COMMIT, c.options.QueueName, msg, err)
+		return err
+	}
+	return nil
+}
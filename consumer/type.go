@@ -1,6 +1,12 @@
 package consumer
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
 
 type Message struct {
 	MsgID      int64                  `json:"msg_id"`
@@ -8,10 +14,48 @@ type Message struct {
 	EnqueuedAt string                 `json:"enqueued_at"`
 	VT         string                 `json:"vt"`
 	Message    map[string]interface{} `json:"message"`
+	Headers    map[string]interface{} `json:"headers"`
+	Raw        json.RawMessage        `json:"-"`
+}
+
+// UnmarshalJSON keeps the raw body in Raw, so bodies that are not json
+// objects are not lost and can be decoded by a typed consumer.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	aux := struct {
+		*message
+		Message json.RawMessage `json:"message"`
+	}{message: (*message)(m)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	m.Raw = aux.Message
+	m.Message = nil
+	// bodies that are not json objects are intentionally left only in Raw,
+	// the typed consumer decodes them and reports the DecodeError
+	_ = json.Unmarshal(aux.Message, &m.Message)
+	return nil
+}
+
+// EnqueuedAtTime parses EnqueuedAt, formatted by the queue drivers in
+// RFC 3339.
+func (m Message) EnqueuedAtTime() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, m.EnqueuedAt)
+}
+
+// VTTime parses VT, the time the message is visible again.
+func (m Message) VTTime() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, m.VT)
 }
 
 type handler func(msg map[string]interface{}) error
 
+// Handler receives the full message and the context that is cancelled when
+// the visibility time of the message expires or the consumer is shut down.
+type Handler func(ctx context.Context, msg Message) error
+
 type ConsumerOptions struct {
 	QueueName                   string
 	VisibilityTime              int
@@ -22,8 +66,29 @@ type ConsumerOptions struct {
 	QueueNameDlq                string
 	TotalRetriesBeforeSendToDlq int64
 	EventListeners              map[string]func(msg Message, err error)
+	StateListener               func(state PollingState)
+	RetryPolicy                 RetryPolicy
+	Codec                       Codec
+	BatchMaxSize                int
+	BatchMaxWaitMs              int
+	AckFlushWindowMs            int
+	CompletionMode              string
+	DlqCompletionMode           string
+	DlqRawBody                  bool
+	Logger                      *slog.Logger
+	Metrics                     MetricsRecorder
+	Tracer                      Tracer
+	Transactional               bool
+	Middlewares                 []Middleware
+	Notifier                    Notifier
+	TimeMsSafetyPolling         int
+	MaxPollSeconds              int
+	PollIntervalMs              int
+	EnsureQueues                bool
 }
 
+type PollingState string
+
 type QueueDriver interface {
 	Send(
 		queueName string,
@@ -45,9 +110,73 @@ type QueueDriver interface {
 		queueName string,
 		messageID int64,
 	) error
+
+	Archive(
+		queueName string,
+		messageID int64,
+	) error
+
+	SetVisibilityTime(
+		queueName string,
+		messageID int64,
+		visibilityTime int,
+	) error
+}
+
+// HeadersSender is implemented by queue drivers able to send message
+// headers, supported since pgmq 1.5.
+type HeadersSender interface {
+	SendWithHeaders(
+		queueName string,
+		message map[string]interface{},
+		headers map[string]interface{},
+		signal context.Context,
+	) error
 }
 
 const EVENT_LISTENER_FINISH = "finish"
 const EVENT_LISTENER_ERROR = "error"
 const EVENT_LISTENER_ABORT_ERROR = "abort-error"
 const EVENT_LISTENER_SEND_TO_DLQ = "send-to-dlq"
+const EVENT_LISTENER_NOT_STARTED = "not-started"
+const EVENT_LISTENER_RETRY = "retry"
+const EVENT_LISTENER_DRIVER_ERROR = "driver-error"
+const EVENT_LISTENER_DUPLICATE = "duplicate"
+
+const POLLING_STATE_IDLE PollingState = "idle"
+const POLLING_STATE_FETCHING PollingState = "fetching"
+const POLLING_STATE_BACKING_OFF PollingState = "backing-off"
+const POLLING_STATE_LISTENING PollingState = "listening"
+const POLLING_STATE_DISPATCHING PollingState = "dispatching"
+const POLLING_STATE_STOPPED PollingState = "stopped"
+
+const COMPLETION_MODE_DELETE = "delete"
+const COMPLETION_MODE_ARCHIVE = "archive"
+
+const DRIVER_OPERATION_GET = "get"
+const DRIVER_OPERATION_READ_WITH_POLL = "read_with_poll"
+const DRIVER_OPERATION_POP = "pop"
+const DRIVER_OPERATION_SEND = "send"
+const DRIVER_OPERATION_DELETE = "delete"
+const DRIVER_OPERATION_ARCHIVE = "archive"
+const DRIVER_OPERATION_SET_VT = "set_vt"
+const DRIVER_OPERATION_BEGIN = "begin"
+const DRIVER_OPERATION_COMMIT = "commit"
+const DRIVER_OPERATION_LISTEN = "listen"
+const DRIVER_OPERATION_CREATE = "create"
+
+// DriverError is notified to EVENT_LISTENER_DRIVER_ERROR when a queue
+// driver operation fails.
+type DriverError struct {
+	Operation string
+	QueueName string
+	Err       error
+}
+
+func (e *DriverError) Error() string {
+	return fmt.Sprintf("error executing %s on queue %s: %s", e.Operation, e.QueueName, e.Err.Error())
+}
+
+func (e *DriverError) Unwrap() error {
+	return e.Err
+}
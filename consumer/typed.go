@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type TypedHandler[T any] func(ctx context.Context, payload T, msg Message) error
+
+// NewTypedConsumer creates a consumer whose handler receives the message body
+// decoded to T using options.Codec, JSONCodec by default.
+func NewTypedConsumer[T any](
+	handler TypedHandler[T],
+	options ConsumerOptions,
+	queueDriver QueueDriver,
+) (*Consumer, error) {
+	codec := options.Codec
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return NewConsumerWithHandler(func(ctx context.Context, msg Message) error {
+		body, err := messageBody(msg)
+		if err != nil {
+			return &DecodeError{Err: err}
+		}
+
+		var payload T
+		if err := codec.Decode(body, &payload); err != nil {
+			return &DecodeError{Err: err}
+		}
+
+		return handler(ctx, payload, msg)
+	}, options, queueDriver)
+}
+
+func messageBody(msg Message) ([]byte, error) {
+	if len(msg.Raw) > 0 {
+		return msg.Raw, nil
+	}
+	return json.Marshal(msg.Message)
+}
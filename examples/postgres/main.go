@@ -1,14 +1,14 @@
 package main
 
-package main
-
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -91,6 +91,19 @@ func main() {
 		fmt.Println("cannot initalize consumer", err)
 		return
 	}
-	consumer.Start()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := consumer.Shutdown(shutdownCtx); err != nil {
+			fmt.Println("cannot shutdown consumer gracefully", err)
+		}
+	}()
+
+	if err := consumer.Run(ctx); err != nil {
+		fmt.Println("consumer stopped with error", err)
+	}
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/supabase-community/supabase-go"
@@ -58,6 +62,19 @@ func main() {
 		fmt.Println("cannot initalize consumer", err)
 		return
 	}
-	consumer.Start()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := consumer.Shutdown(shutdownCtx); err != nil {
+			fmt.Println("cannot shutdown consumer gracefully", err)
+		}
+	}()
+
+	if err := consumer.Run(ctx); err != nil {
+		fmt.Println("consumer stopped with error", err)
+	}
 }
@@ -2,6 +2,7 @@ package fakeMock
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/tiago123456789/consumer-pgmq-go/consumer"
@@ -26,8 +27,83 @@ func (m *MockQueueDriver) Delete(queueName string, msgID int64) error {
 	return args.Error(0)
 }
 
+func (m *MockQueueDriver) Archive(queueName string, msgID int64) error {
+	args := m.Called(queueName, msgID)
+	return args.Error(0)
+}
+
 func (m *MockQueueDriver) Send(queueName string, message map[string]interface{}, signal context.Context,
 ) error {
 	args := m.Called(queueName, message, signal)
 	return args.Error(0)
 }
+
+func (m *MockQueueDriver) SendWithHeaders(queueName string, message map[string]interface{}, headers map[string]interface{}, signal context.Context,
+) error {
+	args := m.Called(queueName, message, headers, signal)
+	return args.Error(0)
+}
+
+func (m *MockQueueDriver) SendMessages(queueName string, messages []json.RawMessage, headers []map[string]interface{}, delaySeconds int, signal context.Context,
+) ([]int64, error) {
+	args := m.Called(queueName, messages, headers, delaySeconds, signal)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockQueueDriver) SetVisibilityTime(queueName string, msgID int64, visibilityTime int) error {
+	args := m.Called(queueName, msgID, visibilityTime)
+	return args.Error(0)
+}
+
+type MockBatchQueueDriver struct {
+	MockQueueDriver
+}
+
+func (m *MockBatchQueueDriver) DeleteBatch(queueName string, msgIDs []int64) error {
+	args := m.Called(queueName, msgIDs)
+	return args.Error(0)
+}
+
+func (m *MockBatchQueueDriver) ArchiveBatch(queueName string, msgIDs []int64) error {
+	args := m.Called(queueName, msgIDs)
+	return args.Error(0)
+}
+
+func (m *MockBatchQueueDriver) SendBatch(queueName string, messages []map[string]interface{}, signal context.Context,
+) error {
+	args := m.Called(queueName, messages, signal)
+	return args.Error(0)
+}
+
+type MockBatchCompleterQueueDriver struct {
+	MockBatchQueueDriver
+}
+
+func (m *MockBatchCompleterQueueDriver) CompleteBatch(queueName string, deleteIDs []int64, archiveIDs []int64) error {
+	args := m.Called(queueName, deleteIDs, archiveIDs)
+	return args.Error(0)
+}
+
+type MockTransactionalQueueDriver struct {
+	MockQueueDriver
+}
+
+func (m *MockTransactionalQueueDriver) BeginTransaction(ctx context.Context) (consumer.Transaction, error) {
+	args := m.Called(ctx)
+	tx, _ := args.Get(0).(consumer.Transaction)
+	return tx, args.Error(1)
+}
+
+type MockTransaction struct {
+	MockQueueDriver
+}
+
+func (m *MockTransaction) Commit() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockTransaction) Rollback() error {
+	args := m.Called()
+	return args.Error(0)
+}
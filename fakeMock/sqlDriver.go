@@ -0,0 +1,145 @@
+package fakeMock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+)
+
+// SqlDriver is a database/sql driver answering the queries with the rows
+// registered by On and recording the statements executed, including BEGIN,
+// COMMIT and ROLLBACK.
+type SqlDriver struct {
+	mutex      sync.Mutex
+	results    []sqlResult
+	statements []string
+}
+
+type sqlResult struct {
+	contains string
+	columns  []string
+	rows     [][]driver.Value
+}
+
+func NewSqlDB() (*sql.DB, *SqlDriver) {
+	sqlDriver := &SqlDriver{}
+	return sql.OpenDB(sqlDriver), sqlDriver
+}
+
+// On registers the rows returned once by the next query containing the text.
+func (d *SqlDriver) On(contains string, columns []string, rows ...[]driver.Value) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.results = append(d.results, sqlResult{contains: contains, columns: columns, rows: rows})
+}
+
+func (d *SqlDriver) Statements() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+func (d *SqlDriver) execute(query string) sqlResult {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.statements = append(d.statements, strings.TrimSpace(query))
+	for i, result := range d.results {
+		if strings.Contains(query, result.contains) {
+			d.results = append(d.results[:i], d.results[i+1:]...)
+			return result
+		}
+	}
+	return sqlResult{}
+}
+
+func (d *SqlDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return &sqlConn{driver: d}, nil
+}
+
+func (d *SqlDriver) Driver() driver.Driver {
+	return d
+}
+
+func (d *SqlDriver) Open(name string) (driver.Conn, error) {
+	return &sqlConn{driver: d}, nil
+}
+
+type sqlConn struct {
+	driver *SqlDriver
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return nil
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	c.driver.execute("BEGIN")
+	return &sqlTx{driver: c.driver}, nil
+}
+
+type sqlTx struct {
+	driver *SqlDriver
+}
+
+func (t *sqlTx) Commit() error {
+	t.driver.execute("COMMIT")
+	return nil
+}
+
+func (t *sqlTx) Rollback() error {
+	t.driver.execute("ROLLBACK")
+	return nil
+}
+
+type sqlStmt struct {
+	driver *SqlDriver
+	query  string
+}
+
+func (s *sqlStmt) Close() error {
+	return nil
+}
+
+func (s *sqlStmt) NumInput() int {
+	return -1
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.execute(s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	result := s.driver.execute(s.query)
+	return &sqlRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type sqlRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *sqlRows) Columns() []string {
+	return r.columns
+}
+
+func (r *sqlRows) Close() error {
+	return nil
+}
+
+func (r *sqlRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 
 	"github.com/joho/godotenv"
 	"github.com/supabase-community/supabase-go"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+	"github.com/tiago123456789/consumer-pgmq-go/producer"
 )
 
 func main() {
@@ -22,16 +25,23 @@ func main() {
 		Schema: "pgmq_public",
 	})
 	if err != nil {
-		fmt.Println("cannot initalize client", err)
+		log.Fatal("cannot initalize client", err)
 	}
 
+	p := producer.NewProducer(queuedriver.NewSupabaseQueueDriver(client), producer.ProducerOptions{})
+
+	messages := make([]producer.Message, 0, 1000)
 	for i := 0; i < 1000; i++ {
-		client.Rpc("send", "", map[string]interface{}{
-			"queue_name": "subscriptions",
-			"message": map[string]interface{}{
+		messages = append(messages, producer.Message{
+			Body: map[string]interface{}{
 				"message": fmt.Sprintf("Hello World %d", i),
 			},
 		})
 	}
 
+	msgIDs, err := p.SendBatch(context.Background(), "subscriptions", messages, 0)
+	if err != nil {
+		log.Fatal("cannot send messages", err)
+	}
+	fmt.Println("messages sent", len(msgIDs))
 }
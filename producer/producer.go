@@ -0,0 +1,126 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+)
+
+// Driver is implemented by the queue drivers of consumer/queueDriver.
+// headers is nil or has one item per message.
+type Driver interface {
+	SendMessages(
+		queueName string,
+		messages []json.RawMessage,
+		headers []map[string]interface{},
+		delaySeconds int,
+		signal context.Context,
+	) ([]int64, error)
+}
+
+type Message struct {
+	// Body is encoded with the codec of the producer, JSONCodec by default.
+	Body    interface{}
+	Headers map[string]interface{}
+}
+
+// Tracer injects the trace context of ctx in the headers of the messages
+// sent. The tracer of the package consumer/tracing implements it.
+type Tracer interface {
+	Inject(ctx context.Context, headers map[string]interface{}) map[string]interface{}
+}
+
+type ProducerOptions struct {
+	Codec  consumer.Codec
+	Tracer Tracer
+}
+
+// Producer sends messages to pgmq queues and returns the ids of the messages
+// sent. It doesn't depend on a Consumer.
+type Producer struct {
+	driver Driver
+	codec  consumer.Codec
+	tracer Tracer
+}
+
+func NewProducer(driver Driver, options ProducerOptions) *Producer {
+	codec := options.Codec
+	if codec == nil {
+		codec = consumer.JSONCodec{}
+	}
+
+	return &Producer{driver: driver, codec: codec, tracer: options.Tracer}
+}
+
+func (p *Producer) Send(ctx context.Context, queueName string, message Message) (int64, error) {
+	return p.SendDelayed(ctx, queueName, message, 0)
+}
+
+// SendDelayed sends the message visible only after delay, rounded up to
+// seconds.
+func (p *Producer) SendDelayed(ctx context.Context, queueName string, message Message, delay time.Duration) (int64, error) {
+	msgIDs, err := p.send(ctx, queueName, []Message{message}, delay)
+	if err != nil {
+		return 0, err
+	}
+	if len(msgIDs) != 1 {
+		return 0, errors.New("expected one message id returned by the queue")
+	}
+	return msgIDs[0], nil
+}
+
+// SendAt sends the message visible only at the time informed. A time in
+// the past sends the message visible immediately.
+func (p *Producer) SendAt(ctx context.Context, queueName string, message Message, at time.Time) (int64, error) {
+	return p.SendDelayed(ctx, queueName, message, time.Until(at))
+}
+
+// SendBatch sends all messages in one round trip, the ids are returned in
+// the same order of the messages.
+func (p *Producer) SendBatch(ctx context.Context, queueName string, messages []Message, delay time.Duration) ([]int64, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return p.send(ctx, queueName, messages, delay)
+}
+
+func (p *Producer) send(ctx context.Context, queueName string, messages []Message, delay time.Duration) ([]int64, error) {
+	if queueName == "" {
+		return nil, errors.New("queue name must be set")
+	}
+
+	bodies := make([]json.RawMessage, 0, len(messages))
+	var headers []map[string]interface{}
+	for i, message := range messages {
+		body, err := p.codec.Encode(message.Body)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+
+		messageHeaders := message.Headers
+		if p.tracer != nil {
+			messageHeaders = p.tracer.Inject(ctx, messageHeaders)
+		}
+
+		if len(messageHeaders) > 0 {
+			if headers == nil {
+				headers = make([]map[string]interface{}, len(messages))
+			}
+			headers[i] = messageHeaders
+		}
+	}
+
+	return p.driver.SendMessages(queueName, bodies, headers, delaySeconds(delay), ctx)
+}
+
+func delaySeconds(delay time.Duration) int {
+	if delay <= 0 {
+		return 0
+	}
+	return int(math.Ceil(delay.Seconds()))
+}
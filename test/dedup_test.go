@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/dedup"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+)
+
+func TestDedup_MemoryStoreEvictsLeastRecentlyUsedAndExpiredKeys(t *testing.T) {
+	now := time.Now()
+	store := dedup.NewMemoryStore(dedup.MemoryStoreOptions{
+		Capacity: 2,
+		TTL:      time.Minute,
+		Now:      func() time.Time { return now },
+	})
+	ctx := context.Background()
+
+	store.Mark(ctx, "a")
+	store.Mark(ctx, "b")
+	store.Claim(ctx, "a", now.Add(time.Minute))
+	store.Mark(ctx, "c")
+
+	if claimed, _ := store.Claim(ctx, "a", now.Add(time.Minute)); claimed {
+		t.Fatal("Expected key a kept")
+	}
+
+	now = now.Add(time.Minute)
+	if claimed, _ := store.Claim(ctx, "c", now.Add(time.Minute)); !claimed {
+		t.Fatal("Expected key expired after ttl")
+	}
+	if claimed, _ := store.Claim(ctx, "b", now.Add(time.Minute)); !claimed {
+		t.Fatal("Expected least recently used key evicted")
+	}
+}
+
+func TestDedup_MemoryStoreClaimExpiresAndIsReleased(t *testing.T) {
+	now := time.Now()
+	store := dedup.NewMemoryStore(dedup.MemoryStoreOptions{Now: func() time.Time { return now }})
+	ctx := context.Background()
+
+	if claimed, _ := store.Claim(ctx, "a", now.Add(10*time.Second)); !claimed {
+		t.Fatal("Expected key claimed")
+	}
+	if claimed, _ := store.Claim(ctx, "a", now.Add(10*time.Second)); claimed {
+		t.Fatal("Expected key claimed only once")
+	}
+
+	now = now.Add(10 * time.Second)
+	if claimed, _ := store.Claim(ctx, "a", now.Add(10*time.Second)); !claimed {
+		t.Fatal("Expected claim of a crashed worker expired")
+	}
+
+	store.Release(ctx, "a")
+	if claimed, _ := store.Claim(ctx, "a", now.Add(10*time.Second)); !claimed {
+		t.Fatal("Expected key released")
+	}
+
+	store.Mark(ctx, "a")
+	store.Release(ctx, "a")
+	if claimed, _ := store.Claim(ctx, "a", now.Add(10*time.Second)); claimed {
+		t.Fatal("Expected key processed kept after release")
+	}
+}
+
+func TestDedup_MiddlewareRunsHandlerOnceForConcurrentDuplicates(t *testing.T) {
+	store := dedup.NewMemoryStore(dedup.MemoryStoreOptions{})
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := dedup.Middleware(store, "subscriptions", dedup.DedupOptions{})(func(ctx context.Context, msg consumer.Message) error {
+		close(started)
+		<-finish
+		return nil
+	})
+
+	msg := consumer.Message{MsgID: 1}
+	result := make(chan error, 1)
+	go func() { result <- handler(context.Background(), msg) }()
+
+	<-started
+	if err := handler(context.Background(), msg); !errors.Is(err, consumer.ErrDuplicate) {
+		t.Fatal("Expected duplicate while the first worker runs the handler, got", err)
+	}
+
+	close(finish)
+	if err := <-result; err != nil {
+		t.Fatal("Expected first worker processed the message, got", err)
+	}
+}
+
+func TestDedup_MiddlewareReleasesKeyOnErrorAndIgnoresMarkError(t *testing.T) {
+	store := &failingMarkStore{MemoryStore: dedup.NewMemoryStore(dedup.MemoryStoreOptions{})}
+	fail := true
+	handler := dedup.Middleware(store, "subscriptions", dedup.DedupOptions{})(func(ctx context.Context, msg consumer.Message) error {
+		if fail {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	msg := consumer.Message{MsgID: 1}
+	if err := handler(context.Background(), msg); err == nil {
+		t.Fatal("Expected handler error returned")
+	}
+
+	fail = false
+	if err := handler(context.Background(), msg); err != nil {
+		t.Fatal("Expected message retried after release and mark error ignored, got", err)
+	}
+}
+
+type failingMarkStore struct {
+	*dedup.MemoryStore
+}
+
+func (f *failingMarkStore) Mark(ctx context.Context, key string) error {
+	return errors.New("connection closed")
+}
+
+func TestDedup_MiddlewareRemovesDuplicatesAndNotifies(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 1).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, Message: map[string]interface{}{"order_id": "A"}},
+		{MsgID: 2, ReadCT: 1, Message: map[string]interface{}{"order_id": "A"}},
+		{MsgID: 3, ReadCT: 1, Message: map[string]interface{}{"order_id": "B"}},
+	}, nil)
+	queueDriver.On("Delete", "subscriptions", int64(1)).Return(nil)
+	queueDriver.On("Delete", "subscriptions", int64(2)).Return(nil)
+	queueDriver.On("Delete", "subscriptions", int64(3)).Return(nil)
+
+	store := dedup.NewMemoryStore(dedup.MemoryStoreOptions{})
+	middleware := dedup.Middleware(store, "subscriptions", dedup.DedupOptions{
+		Key: func(msg consumer.Message) (string, error) {
+			return msg.Message["order_id"].(string), nil
+		},
+	})
+
+	processed := make(chan string, 3)
+	var duplicates []int64
+	c, _ := consumer.NewConsumerWithHandler(middleware(func(ctx context.Context, msg consumer.Message) error {
+		processed <- msg.Message["order_id"].(string)
+		return nil
+	}), consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		EventListeners: map[string]func(msg consumer.Message, err error){
+			consumer.EVENT_LISTENER_DUPLICATE: func(msg consumer.Message, err error) {
+				duplicates = append(duplicates, msg.MsgID)
+			},
+			consumer.EVENT_LISTENER_ERROR: func(msg consumer.Message, err error) {
+				t.Error("Expected no error for duplicates", err)
+			},
+		},
+	}, queueDriver)
+
+	c.Start()
+	close(processed)
+
+	var orders []string
+	for order := range processed {
+		orders = append(orders, order)
+	}
+	if strings.Join(orders, ",") != "A,B" {
+		t.Fatal("Expected orders A and B processed once, got", orders)
+	}
+	if len(duplicates) != 1 || duplicates[0] != 2 {
+		t.Fatal("Expected message 2 notified as duplicate, got", duplicates)
+	}
+	queueDriver.AssertCalled(t, "Delete", "subscriptions", int64(2))
+}
+
+func TestDedup_PostgresStoreClaimsKeyInTransactionOfMessage(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("pgmq.read", messageColumns,
+		[]driver.Value{int64(1), int64(1), time.Now(), time.Now(), []byte(`{"email":"john@gmail.com"}`), nil},
+	)
+	sqlDriver.On("pgmq.delete", []string{"delete"}, []driver.Value{true})
+
+	store := dedup.NewPostgresStore(db, dedup.PostgresStoreOptions{})
+	middleware := dedup.Middleware(store, "subscriptions", dedup.DedupOptions{})
+
+	c, _ := consumer.NewConsumerWithHandler(middleware(func(ctx context.Context, msg consumer.Message) error {
+		_, err := queuedriver.TxFromContext(ctx).ExecContext(ctx, "INSERT INTO subscriptions(email) VALUES ($1)", msg.Message["email"])
+		return err
+	}), consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		Transactional:  true,
+	}, queuedriver.NewPostgresQueueDriver(db, "pgmq"))
+
+	c.Start()
+
+	statements := statementsContaining(sqlDriver.Statements(), "BEGIN", "INSERT INTO subscriptions", "INSERT INTO pgmq_processed_messages", "pgmq.delete", "COMMIT")
+	expected := []string{"BEGIN", "INSERT INTO pgmq_processed_messages", "INSERT INTO subscriptions", "INSERT INTO pgmq_processed_messages", "pgmq.delete", "COMMIT"}
+	if strings.Join(statements, ",") != strings.Join(expected, ",") {
+		t.Fatal("Expected", expected, "got", statements)
+	}
+}
+
+func TestDedup_DefaultKeyDoesNotCollideBetweenQueues(t *testing.T) {
+	store := dedup.NewMemoryStore(dedup.MemoryStoreOptions{})
+	var processed []string
+	handler := func(ctx context.Context, msg consumer.Message) error {
+		processed = append(processed, msg.Message["queue"].(string))
+		return nil
+	}
+	subscriptions := dedup.Middleware(store, "subscriptions", dedup.DedupOptions{})(handler)
+	payments := dedup.Middleware(store, "payments", dedup.DedupOptions{})(handler)
+
+	msg := consumer.Message{MsgID: 5, Message: map[string]interface{}{"queue": "subscriptions"}}
+	if err := subscriptions(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	msg = consumer.Message{MsgID: 5, Message: map[string]interface{}{"queue": "payments"}}
+	if err := payments(context.Background(), msg); err != nil {
+		t.Fatal("Expected message 5 of another queue processed, got", err)
+	}
+	if err := payments(context.Background(), msg); !errors.Is(err, consumer.ErrDuplicate) {
+		t.Fatal("Expected duplicate in the same queue, got", err)
+	}
+
+	if strings.Join(processed, ",") != "subscriptions,payments" {
+		t.Fatal("Expected both queues processed, got", processed)
+	}
+}
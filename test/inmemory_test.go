@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver/inmemory"
+	"github.com/tiago123456789/consumer-pgmq-go/producer"
+)
+
+func runOnce(t *testing.T, handler consumer.Handler, options consumer.ConsumerOptions, queueDriver consumer.QueueDriver) {
+	options.EnabledPolling = false
+	c, err := consumer.NewConsumerWithHandler(handler, options, queueDriver)
+	if err != nil {
+		t.Fatal("Expected consumer created", err)
+	}
+	c.Start()
+}
+
+func TestInMemory_RedeliversAfterVisibilityTimeAndSendsToDlq(t *testing.T) {
+	clock := inmemory.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{Clock: clock})
+	queueDriver.CreateQueue("subscriptions")
+	queueDriver.CreateQueue("subscriptions_dlq")
+	queueDriver.Send("subscriptions", map[string]interface{}{"email": "john@gmail.com"}, context.Background())
+
+	var readCTs []int64
+	handler := func(ctx context.Context, msg consumer.Message) error {
+		readCTs = append(readCTs, msg.ReadCT)
+		return errors.New("smtp unavailable")
+	}
+	options := consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              30,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 2,
+	}
+
+	runOnce(t, handler, options, queueDriver)
+	clock.Advance(29 * time.Second)
+	runOnce(t, handler, options, queueDriver)
+	if len(readCTs) != 1 {
+		t.Fatal("Expected message invisible before the visibility time, got reads", readCTs)
+	}
+
+	clock.Advance(time.Second)
+	runOnce(t, handler, options, queueDriver)
+	clock.Advance(30 * time.Second)
+	runOnce(t, handler, options, queueDriver)
+
+	if len(readCTs) != 2 || readCTs[0] != 1 || readCTs[1] != 2 {
+		t.Fatal("Expected read_ct incremented on each read, got", readCTs)
+	}
+	if len(queueDriver.Messages("subscriptions")) != 0 {
+		t.Fatal("Expected message removed from main queue")
+	}
+
+	dlq := queueDriver.Messages("subscriptions_dlq")
+	if len(dlq) != 1 {
+		t.Fatal("Expected message in dlq, got", dlq)
+	}
+	envelope, ok := consumer.ParseDlqEnvelope(dlq[0])
+	if !ok || envelope.ReadCT != 3 || envelope.SourceQueue != "subscriptions" || envelope.Body()["email"] != "john@gmail.com" {
+		t.Fatal("Expected dlq envelope, got", envelope)
+	}
+}
+
+func TestInMemory_DelayedSendAndRetryPolicy(t *testing.T) {
+	clock := inmemory.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{Clock: clock})
+	queueDriver.CreateQueue("subscriptions")
+
+	p := producer.NewProducer(queueDriver, producer.ProducerOptions{})
+	msgID, err := p.SendDelayed(context.Background(), "subscriptions", producer.Message{Body: map[string]interface{}{"id": 1}}, time.Minute)
+	if err != nil || msgID != 1 {
+		t.Fatal("Expected message sent, got", msgID, err)
+	}
+
+	reads := 0
+	handler := func(ctx context.Context, msg consumer.Message) error {
+		reads++
+		if reads == 1 {
+			return errors.New("temporary error")
+		}
+		return nil
+	}
+	options := consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 300,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		RetryPolicy:    consumer.FixedRetryPolicy(10 * time.Second),
+	}
+
+	runOnce(t, handler, options, queueDriver)
+	if reads != 0 {
+		t.Fatal("Expected delayed message invisible")
+	}
+
+	clock.Advance(time.Minute)
+	runOnce(t, handler, options, queueDriver)
+	clock.Advance(10 * time.Second)
+	runOnce(t, handler, options, queueDriver)
+
+	if reads != 2 || len(queueDriver.Messages("subscriptions")) != 0 {
+		t.Fatal("Expected message retried after the retry policy delay and deleted, got reads", reads)
+	}
+}
+
+func TestInMemory_PopAndArchive(t *testing.T) {
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{})
+	queueDriver.CreateQueue("subscriptions")
+	queueDriver.SendBatch("subscriptions", []map[string]interface{}{{"id": 1}, {"id": 2}}, context.Background())
+
+	messages, _ := queueDriver.Pop("subscriptions")
+	if len(messages) != 1 || messages[0].MsgID != 1 || messages[0].ReadCT != 0 {
+		t.Fatal("Expected first message popped, got", messages)
+	}
+
+	runOnce(t, func(ctx context.Context, msg consumer.Message) error {
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 30,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		CompletionMode: consumer.COMPLETION_MODE_ARCHIVE,
+	}, queueDriver)
+
+	archived := queueDriver.Archived("subscriptions")
+	if len(queueDriver.Messages("subscriptions")) != 0 || len(archived) != 1 || archived[0].MsgID != 2 {
+		t.Fatal("Expected second message archived, got", archived)
+	}
+
+	if _, err := queueDriver.Get("unknown", 30, 1); err == nil {
+		t.Fatal("Expected error reading queue not created")
+	}
+}
+
+func TestInMemory_ConsumerWakesUpOnNotification(t *testing.T) {
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{})
+	queueDriver.CreateQueue("subscriptions")
+
+	handled := make(chan consumer.Message, 1)
+	listening := make(chan struct{})
+	var once sync.Once
+	c, _ := consumer.NewConsumerWithHandler(func(ctx context.Context, msg consumer.Message) error {
+		handled <- msg
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              30,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		EnabledPolling:              true,
+		TimeMsWaitBeforeNextPolling: int(time.Hour / time.Millisecond),
+		TimeMsSafetyPolling:         int(time.Hour / time.Millisecond),
+		Notifier:                    queueDriver,
+		StateListener: func(state consumer.PollingState) {
+			if state == consumer.POLLING_STATE_LISTENING {
+				once.Do(func() { close(listening) })
+			}
+		},
+	}, queueDriver)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+
+	<-listening
+	queueDriver.Send("subscriptions", map[string]interface{}{"id": 1}, context.Background())
+
+	select {
+	case msg := <-handled:
+		if msg.Message["id"] != float64(1) {
+			t.Fatal("Expected message sent handled, got", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected consumer woken up by the notification")
+	}
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatal("Expected shutdown without error", err)
+	}
+	<-done
+}
+
+func TestInMemory_RedriveSendsBackBodyThatIsNotJsonObject(t *testing.T) {
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{})
+	queueDriver.CreateQueue("subscriptions")
+	queueDriver.CreateQueue("subscriptions_dlq")
+	queueDriver.SendMessages("subscriptions", []json.RawMessage{json.RawMessage(`"hello"`)}, nil, 0, context.Background())
+
+	type subscription struct {
+		Email string `json:"email"`
+	}
+	options := consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              30,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 3,
+		EnabledPolling:              false,
+	}
+	c, err := consumer.NewTypedConsumer(func(ctx context.Context, payload subscription, msg consumer.Message) error {
+		return nil
+	}, options, queueDriver)
+	if err != nil {
+		t.Fatal("Expected consumer created", err)
+	}
+	c.Start()
+
+	if len(queueDriver.Messages("subscriptions_dlq")) != 1 {
+		t.Fatal("Expected message that can't be decoded sent to dlq")
+	}
+
+	result, err := consumer.Redrive(context.Background(), queueDriver, "subscriptions_dlq", "subscriptions", consumer.RedriveOptions{})
+	if err != nil || result.Redriven != 1 {
+		t.Fatal("Expected message redriven, got", result, err)
+	}
+
+	messages := queueDriver.Messages("subscriptions")
+	if len(messages) != 1 || string(messages[0].Raw) != `"hello"` {
+		t.Fatal("Expected original body sent back to the main queue, got", messages)
+	}
+	if len(queueDriver.Messages("subscriptions_dlq")) != 0 {
+		t.Fatal("Expected message removed from dlq")
+	}
+}
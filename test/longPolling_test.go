@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver/inmemory"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+)
+
+func TestPostgresQueueDriver_ReadWithPoll(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("pgmq.read_with_poll", messageColumns,
+		[]driver.Value{int64(1), int64(1), time.Now(), time.Now(), []byte(`{"msg":"hi"}`), nil},
+	)
+
+	messages, err := queuedriver.NewPostgresQueueDriver(db, "pgmq").
+		ReadWithPoll(context.Background(), "subscriptions", 10, 1, 5, 100)
+	if err != nil || len(messages) != 1 || messages[0].Message["msg"] != "hi" {
+		t.Fatal("Expected 1 message, got", messages, err)
+	}
+}
+
+func TestConsumer_LongPollingRequiresReadAndLongPoller(t *testing.T) {
+	handler := func(msg map[string]interface{}) error { return nil }
+
+	_, err := consumer.NewConsumer(handler, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		ConsumerType:   "pop",
+		PoolSize:       1,
+		MaxPollSeconds: 5,
+	}, inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{}))
+	if err == nil {
+		t.Fatal("Expected error using long polling with pop")
+	}
+
+	_, err = consumer.NewConsumer(handler, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		ConsumerType:   "read",
+		PoolSize:       1,
+		MaxPollSeconds: 5,
+	}, new(fakeMock.MockQueueDriver))
+	if err == nil {
+		t.Fatal("Expected error using long polling with driver without read_with_poll")
+	}
+}
+
+func TestConsumer_LongPollingWakesUpAndShutdownCancelsRead(t *testing.T) {
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{})
+	queueDriver.CreateQueue("subscriptions")
+
+	handled := make(chan consumer.Message, 1)
+	driverErrors := make(chan error, 1)
+	fetching := make(chan struct{})
+	var once sync.Once
+	c, err := consumer.NewConsumerWithHandler(func(ctx context.Context, msg consumer.Message) error {
+		handled <- msg
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              30,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		EnabledPolling:              true,
+		TimeMsWaitBeforeNextPolling: int(time.Hour / time.Millisecond),
+		MaxPollSeconds:              60,
+		PollIntervalMs:              int(time.Hour / time.Millisecond),
+		EventListeners: map[string]func(msg consumer.Message, err error){
+			consumer.EVENT_LISTENER_DRIVER_ERROR: func(msg consumer.Message, err error) {
+				driverErrors <- err
+			},
+		},
+		StateListener: func(state consumer.PollingState) {
+			if state == consumer.POLLING_STATE_FETCHING {
+				once.Do(func() { close(fetching) })
+			}
+		},
+	}, queueDriver)
+	if err != nil {
+		t.Fatal("Expected consumer created", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+
+	<-fetching
+	queueDriver.Send("subscriptions", map[string]interface{}{"id": 1}, context.Background())
+
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected message read by the long polling")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Shutdown(shutdownCtx); err != nil {
+		t.Fatal("Expected shutdown to cancel the long polling", err)
+	}
+	<-done
+
+	select {
+	case err := <-driverErrors:
+		t.Fatal("Expected cancelled read not notified as driver error, got", err)
+	default:
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/metrics"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+)
+
+func TestMetrics_CollectorRecordsConsumerMetrics(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 3).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, EnqueuedAt: time.Now().Add(-time.Second).Format(time.RFC3339Nano), Message: map[string]interface{}{"ok": true}},
+		{MsgID: 2, ReadCT: 1, EnqueuedAt: time.Now().Format(time.RFC3339Nano), Message: map[string]interface{}{"ok": false}},
+		{MsgID: 3, ReadCT: 3, EnqueuedAt: time.Now().Format(time.RFC3339Nano), Message: map[string]interface{}{"ok": true}},
+	}, nil)
+	queueDriver.On("Delete", "subscriptions", int64(1)).Return(nil)
+	queueDriver.On("Delete", "subscriptions", int64(3)).Return(nil)
+	queueDriver.On("Send", "subscriptions_dlq", map[string]interface{}{"ok": true}, context.Background()).Return(nil)
+
+	collector := metrics.NewCollector(metrics.CollectorOptions{})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		if msg["ok"] == false {
+			return errors.New("error processing message")
+		}
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              10,
+		ConsumerType:                "read",
+		PoolSize:                    3,
+		TimeMsWaitBeforeNextPolling: 1,
+		EnabledPolling:              false,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 2,
+		DlqRawBody:                  true,
+		Metrics:                     collector,
+		EventListeners:              map[string]func(msg consumer.Message, err error){},
+	}, queueDriver)
+
+	c.Start()
+
+	expected := map[string]float64{
+		"pgmq_consumer_messages_fetched_total":       3,
+		"pgmq_consumer_messages_processed_total":     1,
+		"pgmq_consumer_messages_failed_total":        1,
+		"pgmq_consumer_messages_dead_lettered_total": 1,
+		"pgmq_consumer_messages_aborted_total":       0,
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal("Expected metrics gathered", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() != "subscriptions" {
+				t.Fatal("Expected metrics labeled by queue, got", metric.GetLabel())
+			}
+			if metric.GetCounter() != nil {
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Fatal("Expected", name, "equal", value, "got", values[name])
+		}
+	}
+
+	if testutil.CollectAndCount(collector, "pgmq_consumer_handler_duration_seconds") != 2 {
+		t.Fatal("Expected handler duration by success and error")
+	}
+	if testutil.CollectAndCount(collector, "pgmq_consumer_end_to_end_latency_seconds") != 1 {
+		t.Fatal("Expected end to end latency of the message processed")
+	}
+	if testutil.CollectAndCount(collector, "pgmq_consumer_workers_in_flight") != 1 {
+		t.Fatal("Expected workers in flight gauge")
+	}
+}
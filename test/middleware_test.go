@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+)
+
+func TestMiddleware_AppliedInOrder(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 1).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, Message: map[string]interface{}{"msg": "hi"}},
+	}, nil)
+	queueDriver.On("Delete", "subscriptions", int64(1)).Return(nil)
+
+	var calls []string
+	trace := func(name string) consumer.Middleware {
+		return func(next consumer.Handler) consumer.Handler {
+			return func(ctx context.Context, msg consumer.Message) error {
+				calls = append(calls, name+":before")
+				err := next(ctx, msg)
+				calls = append(calls, name+":after")
+				return err
+			}
+		}
+	}
+
+	var duration time.Duration
+	c, _ := consumer.NewConsumerWithHandler(func(ctx context.Context, msg consumer.Message) error {
+		calls = append(calls, "handler")
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		Middlewares: []consumer.Middleware{
+			trace("first"),
+			trace("second"),
+			consumer.TimingMiddleware(func(msg consumer.Message, elapsed time.Duration, err error) {
+				duration = elapsed
+			}),
+		},
+	}, queueDriver)
+
+	c.Start()
+
+	expected := "first:before,second:before,handler,second:after,first:after"
+	if strings.Join(calls, ",") != expected {
+		t.Fatal("Expected", expected, "got", calls)
+	}
+	if duration <= 0 {
+		t.Fatal("Expected duration observed by timing middleware")
+	}
+}
+
+func TestMiddleware_RecoverConvertsPanicToError(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 1).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, Message: map[string]interface{}{"msg": "hi"}},
+	}, nil)
+	queueDriver.On("SetVisibilityTime", "subscriptions", int64(1), 5).Return(nil)
+
+	var handlerErr error
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		panic("nil pointer")
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		RetryPolicy:    consumer.FixedRetryPolicy(5 * time.Second),
+		Middlewares:    []consumer.Middleware{consumer.RecoverMiddleware()},
+		EventListeners: map[string]func(msg consumer.Message, err error){
+			consumer.EVENT_LISTENER_ERROR: func(msg consumer.Message, err error) {
+				handlerErr = err
+			},
+		},
+	}, queueDriver)
+
+	c.Start()
+
+	var panicErr *consumer.PanicError
+	if !errors.As(handlerErr, &panicErr) || panicErr.Value != "nil pointer" || len(panicErr.Stack) == 0 {
+		t.Fatal("Expected panic error, got", handlerErr)
+	}
+	queueDriver.AssertCalled(t, "SetVisibilityTime", "subscriptions", int64(1), 5)
+}
+
+func TestMiddleware_ValidationSendsInvalidMessageToDlq(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 1).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, Message: map[string]interface{}{"msg": "hi"}},
+	}, nil)
+	queueDriver.On("Send", "subscriptions_dlq", map[string]interface{}{"msg": "hi"}, context.Background()).Return(nil)
+	queueDriver.On("Delete", "subscriptions", int64(1)).Return(nil)
+
+	called := false
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		called = true
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              10,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		EnabledPolling:              false,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 3,
+		DlqRawBody:                  true,
+		Middlewares: []consumer.Middleware{
+			consumer.ValidationMiddleware(func(msg consumer.Message) error {
+				if msg.Message["email"] == nil {
+					return errors.New("email is required")
+				}
+				return nil
+			}),
+		},
+	}, queueDriver)
+
+	c.Start()
+
+	if called {
+		t.Fatal("Expected handler not called for invalid message")
+	}
+	queueDriver.AssertCalled(t, "Send", "subscriptions_dlq", map[string]interface{}{"msg": "hi"}, context.Background())
+}
+
+func TestMiddleware_LoggingLogsEachMessage(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 1).Return([]consumer.Message{
+		{MsgID: 7, ReadCT: 1, Message: map[string]interface{}{"msg": "hi"}},
+	}, nil)
+	queueDriver.On("Delete", "subscriptions", int64(7)).Return(nil)
+
+	var buffer bytes.Buffer
+	var mutex sync.Mutex
+	logger := slog.New(slog.NewJSONHandler(&lockedWriter{writer: &buffer, mutex: &mutex}, nil))
+
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		Middlewares:    []consumer.Middleware{consumer.LoggingMiddleware(logger)},
+	}, queueDriver)
+
+	c.Start()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	logs := buffer.String()
+	if !strings.Contains(logs, `"msg":"message received","msg_id":7`) || !strings.Contains(logs, `"msg":"message handled","msg_id":7`) {
+		t.Fatal("Expected message logged, got", logs)
+	}
+}
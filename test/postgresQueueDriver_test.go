@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+)
+
+var messageColumns = []string{"msg_id", "read_ct", "enqueued_at", "vt", "message", "headers"}
+
+func statementsContaining(statements []string, texts ...string) []string {
+	var result []string
+	for _, statement := range statements {
+		for _, text := range texts {
+			if strings.Contains(statement, text) {
+				result = append(result, text)
+			}
+		}
+	}
+	return result
+}
+
+func TestPostgresQueueDriver_GetReadsHeadersColumn(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("pgmq.read", messageColumns,
+		[]driver.Value{int64(1), int64(2), time.Now(), time.Now(), []byte(`{"msg":"hi"}`), []byte(`{"tenant-id":"acme"}`)},
+	)
+
+	messages, err := queuedriver.NewPostgresQueueDriver(db, "pgmq").Get("subscriptions", 10, 1)
+	if err != nil || len(messages) != 1 {
+		t.Fatal("Expected 1 message, got", messages, err)
+	}
+	if messages[0].MsgID != 1 || messages[0].ReadCT != 2 || messages[0].Message["msg"] != "hi" ||
+		messages[0].Header(consumer.HEADER_TENANT_ID) != "acme" || messages[0].EnqueuedAt == "" {
+		t.Fatal("Expected message read by columns, got", messages[0])
+	}
+}
+
+func TestPostgresQueueDriver_TxConsumerCommitsHandlerAndDelete(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("pgmq.read", messageColumns,
+		[]driver.Value{int64(1), int64(1), time.Now(), time.Now(), []byte(`{"email":"john@gmail.com"}`), nil},
+	)
+	sqlDriver.On("pgmq.delete", []string{"delete"}, []driver.Value{true})
+
+	c, err := queuedriver.NewTxConsumer(func(ctx context.Context, tx *sql.Tx, msg consumer.Message) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO subscriptions(email) VALUES ($1)", msg.Message["email"])
+		return err
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+	}, queuedriver.NewPostgresQueueDriver(db, "pgmq"))
+	if err != nil {
+		t.Fatal("Expected consumer created", err)
+	}
+
+	c.Start()
+
+	statements := statementsContaining(sqlDriver.Statements(), "BEGIN", "INSERT", "pgmq.delete", "COMMIT", "ROLLBACK")
+	expected := []string{"BEGIN", "INSERT", "pgmq.delete", "COMMIT"}
+	if strings.Join(statements, ",") != strings.Join(expected, ",") {
+		t.Fatal("Expected", expected, "got", statements)
+	}
+}
+
+func TestPostgresQueueDriver_TxConsumerRollbacksWhenMessageAlreadyDeleted(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("pgmq.read", messageColumns,
+		[]driver.Value{int64(1), int64(1), time.Now(), time.Now(), []byte(`{"email":"john@gmail.com"}`), nil},
+	)
+	sqlDriver.On("pgmq.delete", []string{"delete"}, []driver.Value{false})
+
+	var driverErr error
+	c, _ := queuedriver.NewTxConsumer(func(ctx context.Context, tx *sql.Tx, msg consumer.Message) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO subscriptions(email) VALUES ($1)", msg.Message["email"])
+		return err
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		EventListeners: map[string]func(msg consumer.Message, err error){
+			consumer.EVENT_LISTENER_DRIVER_ERROR: func(msg consumer.Message, err error) {
+				driverErr = err
+			},
+		},
+	}, queuedriver.NewPostgresQueueDriver(db, "pgmq"))
+
+	c.Start()
+
+	statements := statementsContaining(sqlDriver.Statements(), "BEGIN", "INSERT", "pgmq.delete", "COMMIT", "ROLLBACK")
+	expected := []string{"BEGIN", "INSERT", "pgmq.delete", "ROLLBACK"}
+	if strings.Join(statements, ",") != strings.Join(expected, ",") {
+		t.Fatal("Expected", expected, "got", statements)
+	}
+	if !errors.Is(driverErr, queuedriver.ErrMessageNotFound) {
+		t.Fatal("Expected message not found driver error, got", driverErr)
+	}
+}
+
+func TestPostgresQueueDriver_CastsDelayAndVisibilityTimeToInteger(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("SELECT EXISTS", []string{"exists"}, []driver.Value{true})
+	sqlDriver.On("pgmq.send_batch", []string{"send_batch"}, []driver.Value{int64(1)})
+
+	queueDriver := queuedriver.NewPostgresQueueDriver(db, "pgmq")
+	ctx := context.Background()
+	queueDriver.Send("subscriptions", map[string]interface{}{"id": 1}, ctx)
+	queueDriver.SendWithHeaders("subscriptions", map[string]interface{}{"id": 1}, map[string]interface{}{"tenant-id": "acme"}, ctx)
+	queueDriver.SendMessages("subscriptions", []json.RawMessage{json.RawMessage(`{"id":1}`)}, nil, 0, ctx)
+	queueDriver.SetVisibilityTime("subscriptions", 1, 10)
+
+	// pgmq 1.5 overloads send, send_batch and set_vt with timestamptz, so
+	// an untyped parameter is ambiguous.
+	var statements []string
+	for _, statement := range sqlDriver.Statements() {
+		if strings.Contains(statement, "pgmq.send") || strings.Contains(statement, "pgmq.set_vt") {
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) != 4 {
+		t.Fatal("Expected 4 statements, got", statements)
+	}
+	for _, statement := range statements {
+		if !strings.Contains(statement, "::integer") {
+			t.Fatal("Expected delay and visibility time cast to integer, got", statement)
+		}
+	}
+}
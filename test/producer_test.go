@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/tracing"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+	"github.com/tiago123456789/consumer-pgmq-go/producer"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestProducer_SendReturnsMessageID(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("SendMessages", "subscriptions", []json.RawMessage{json.RawMessage(`{"email":"a@b.com","plan":"pro"}`)},
+		[]map[string]interface{}(nil), 0, context.Background()).Return([]int64{42}, nil)
+
+	p := producer.NewProducer(queueDriver, producer.ProducerOptions{})
+	msgID, err := p.Send(context.Background(), "subscriptions", producer.Message{Body: subscription{Email: "a@b.com", Plan: "pro"}})
+	if err != nil || msgID != 42 {
+		t.Fatal("Expected message id 42, got", msgID, err)
+	}
+}
+
+func TestProducer_SendDelayedAndSendAt(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("SendMessages", "subscriptions", mock.Anything, mock.Anything, 2, context.Background()).Return([]int64{1}, nil)
+	queueDriver.On("SendMessages", "subscriptions", mock.Anything, mock.Anything, 60, context.Background()).Return([]int64{2}, nil)
+	queueDriver.On("SendMessages", "subscriptions", mock.Anything, mock.Anything, 0, context.Background()).Return([]int64{3}, nil)
+
+	p := producer.NewProducer(queueDriver, producer.ProducerOptions{})
+	message := producer.Message{Body: map[string]interface{}{"id": 1}}
+
+	msgID, err := p.SendDelayed(context.Background(), "subscriptions", message, 1500*time.Millisecond)
+	if err != nil || msgID != 1 {
+		t.Fatal("Expected delay rounded up to 2 seconds, got", msgID, err)
+	}
+
+	msgID, err = p.SendAt(context.Background(), "subscriptions", message, time.Now().Add(time.Minute))
+	if err != nil || msgID != 2 {
+		t.Fatal("Expected delay of 60 seconds, got", msgID, err)
+	}
+
+	msgID, err = p.SendAt(context.Background(), "subscriptions", message, time.Now().Add(-time.Minute))
+	if err != nil || msgID != 3 {
+		t.Fatal("Expected no delay for time in the past, got", msgID, err)
+	}
+}
+
+func TestProducer_SendBatchWithHeaders(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("SendMessages", "subscriptions",
+		[]json.RawMessage{json.RawMessage(`{"id":1}`), json.RawMessage(`{"id":2}`)},
+		[]map[string]interface{}{nil, {"tenant-id": "acme"}},
+		0, context.Background()).Return([]int64{1, 2}, nil)
+
+	p := producer.NewProducer(queueDriver, producer.ProducerOptions{})
+	msgIDs, err := p.SendBatch(context.Background(), "subscriptions", []producer.Message{
+		{Body: map[string]interface{}{"id": 1}},
+		{Body: map[string]interface{}{"id": 2}, Headers: map[string]interface{}{"tenant-id": "acme"}},
+	}, 0)
+	if err != nil || len(msgIDs) != 2 {
+		t.Fatal("Expected 2 message ids, got", msgIDs, err)
+	}
+}
+
+func TestProducer_EncodeErrorIsReturned(t *testing.T) {
+	queueDriver := new(fakeMock.MockQueueDriver)
+
+	p := producer.NewProducer(queueDriver, producer.ProducerOptions{})
+	_, err := p.Send(context.Background(), "subscriptions", producer.Message{Body: make(chan int)})
+	if err == nil {
+		t.Fatal("Expected encode error")
+	}
+	queueDriver.AssertNotCalled(t, "SendMessages", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProducer_TracerInjectsTraceContextInHeaders(t *testing.T) {
+	tracerProvider := sdktrace.NewTracerProvider()
+	ctx, span := tracerProvider.Tracer("test").Start(context.Background(), "checkout")
+	defer span.End()
+
+	queueDriver := new(fakeMock.MockQueueDriver)
+	var sentHeaders []map[string]interface{}
+	queueDriver.On("SendMessages", "subscriptions", mock.Anything, mock.Anything, 0, ctx).
+		Run(func(args mock.Arguments) {
+			sentHeaders = args.Get(2).([]map[string]interface{})
+		}).Return([]int64{1, 2}, nil)
+
+	p := producer.NewProducer(queueDriver, producer.ProducerOptions{
+		Tracer: tracing.NewTracer(tracing.TracerOptions{TracerProvider: tracerProvider}),
+	})
+	_, err := p.SendBatch(ctx, "subscriptions", []producer.Message{
+		{Body: map[string]interface{}{"id": 1}},
+		{Body: map[string]interface{}{"id": 2}, Headers: map[string]interface{}{"tenant-id": "acme"}},
+	}, 0)
+	if err != nil {
+		t.Fatal("Expected messages sent", err)
+	}
+
+	if len(sentHeaders) != 2 || sentHeaders[0]["traceparent"] == nil || sentHeaders[1]["traceparent"] == nil {
+		t.Fatal("Expected traceparent injected in the headers of all messages, got", sentHeaders)
+	}
+	if sentHeaders[1]["tenant-id"] != "acme" {
+		t.Fatal("Expected headers of the message kept, got", sentHeaders[1])
+	}
+}
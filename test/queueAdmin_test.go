@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver/inmemory"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+)
+
+func TestPostgresQueueDriver_MetricsOfEmptyQueue(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	scrapeTime := time.Now()
+	sqlDriver.On("pgmq.metrics",
+		[]string{"queue_name", "queue_length", "newest_msg_age_sec", "oldest_msg_age_sec", "total_messages", "scrape_time", "queue_visible_length"},
+		[]driver.Value{"subscriptions", int64(0), nil, nil, int64(10), scrapeTime, int64(0)},
+	)
+
+	metrics, err := queuedriver.NewPostgresQueueDriver(db, "pgmq").Metrics(context.Background(), "subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.QueueName != "subscriptions" || metrics.TotalMessages != 10 || metrics.NewestMsgAgeSec != nil ||
+		metrics.OldestMsgAgeSec != nil || !metrics.ScrapeTime.Equal(scrapeTime) {
+		t.Fatal("Expected metrics read by columns, got", metrics)
+	}
+}
+
+func TestPostgresQueueDriver_ListQueues(t *testing.T) {
+	db, sqlDriver := fakeMock.NewSqlDB()
+	sqlDriver.On("pgmq.list_queues",
+		[]string{"queue_name", "is_partitioned", "is_unlogged", "created_at"},
+		[]driver.Value{"subscriptions", false, true, time.Now()},
+		[]driver.Value{"subscriptions_dlq", false, false, time.Now()},
+	)
+
+	queues, err := queuedriver.NewPostgresQueueDriver(db, "pgmq").ListQueues(context.Background())
+	if err != nil || len(queues) != 2 || queues[0].QueueName != "subscriptions" || !queues[0].IsUnlogged {
+		t.Fatal("Expected 2 queues, got", queues, err)
+	}
+}
+
+func TestConsumer_EnsureQueuesCreatesQueueAndDlq(t *testing.T) {
+	queueDriver := inmemory.NewInMemoryQueueDriver(inmemory.InMemoryOptions{})
+
+	c, err := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              30,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		TimeMsWaitBeforeNextPolling: 10,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 2,
+		EnsureQueues:                true,
+	}, queueDriver)
+	if err != nil {
+		t.Fatal("Expected consumer created", err)
+	}
+
+	queues, _ := queueDriver.ListQueues(context.Background())
+	if len(queues) != 0 {
+		t.Fatal("Expected no queue created by NewConsumer, got", queues)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal("Expected consumer stopped without error, got", err)
+	}
+
+	queues, _ = queueDriver.ListQueues(context.Background())
+	if len(queues) != 2 || queues[0].QueueName != "subscriptions" || queues[1].QueueName != "subscriptions_dlq" {
+		t.Fatal("Expected queue and dlq created, got", queues)
+	}
+}
+
+func TestConsumer_EnsureQueuesErrors(t *testing.T) {
+	handler := func(msg map[string]interface{}) error { return nil }
+	options := consumer.ConsumerOptions{
+		QueueName:    "subscriptions",
+		ConsumerType: "read",
+		PoolSize:     1,
+		EnsureQueues: true,
+	}
+
+	if _, err := consumer.NewConsumer(handler, options, new(fakeMock.MockQueueDriver)); err == nil {
+		t.Fatal("Expected error using EnsureQueues with driver without QueueAdmin")
+	}
+
+	db, _ := fakeMock.NewSqlDB()
+	db.Close()
+	var notified error
+	options.EventListeners = map[string]func(msg consumer.Message, err error){
+		consumer.EVENT_LISTENER_DRIVER_ERROR: func(msg consumer.Message, err error) {
+			notified = err
+		},
+	}
+	c, err := consumer.NewConsumer(handler, options, queuedriver.NewPostgresQueueDriver(db, "pgmq"))
+	if err != nil {
+		t.Fatal("Expected consumer created without connecting, got", err)
+	}
+
+	err = c.Run(context.Background())
+	var driverErr *consumer.DriverError
+	if !errors.As(err, &driverErr) || driverErr.Operation != consumer.DRIVER_OPERATION_CREATE || driverErr.QueueName != "subscriptions" {
+		t.Fatal("Expected create error returned, got", err)
+	}
+	if !errors.As(notified, &driverErr) {
+		t.Fatal("Expected create error notified, got", notified)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/supabase-community/supabase-go"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	queuedriver "github.com/tiago123456789/consumer-pgmq-go/consumer/queueDriver"
+)
+
+// newSupabaseStub answers the rpcs with the responses by function name and
+// records the functions called with their bodies.
+func newSupabaseStub(t *testing.T, responses map[string]func(w http.ResponseWriter)) (*queuedriver.SupabaseQueueDriver, func() []string) {
+	var mutex sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		function := strings.TrimPrefix(r.URL.Path, "/rest/v1/rpc/")
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		calls = append(calls, function+" "+string(body))
+		mutex.Unlock()
+
+		respond, ok := responses[function]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"PGRST202","message":"Could not find the function"}`))
+			return
+		}
+		respond(w)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := supabase.NewClient(server.URL, "key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queuedriver.NewSupabaseQueueDriver(client), func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+func noContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func jsonResponse(body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+func TestSupabaseQueueDriver_CreateQueueContextAcceptsVoidResponse(t *testing.T) {
+	queueDriver, calls := newSupabaseStub(t, map[string]func(w http.ResponseWriter){
+		"create":             noContent,
+		"create_unlogged":    noContent,
+		"create_partitioned": noContent,
+	})
+	ctx := context.Background()
+
+	if err := queueDriver.CreateQueueContext(ctx, "subscriptions"); err != nil {
+		t.Fatal("Expected create with empty response succeed, got", err)
+	}
+	if err := queueDriver.CreateUnloggedQueue(ctx, "subscriptions"); err != nil {
+		t.Fatal("Expected create_unlogged with empty response succeed, got", err)
+	}
+	if err := queueDriver.CreatePartitionedQueue(ctx, "subscriptions", "10000", "100000"); err != nil {
+		t.Fatal("Expected create_partitioned with empty response succeed, got", err)
+	}
+
+	var body map[string]interface{}
+	json.Unmarshal([]byte(strings.SplitN(calls()[2], " ", 2)[1]), &body)
+	if body["queue_name"] != "subscriptions" || body["partition_interval"] != "10000" || body["retention_interval"] != "100000" {
+		t.Fatal("Expected create_partitioned parameters, got", body)
+	}
+}
+
+func TestSupabaseQueueDriver_CreateQueueContextReturnsPostgrestError(t *testing.T) {
+	queueDriver, _ := newSupabaseStub(t, map[string]func(w http.ResponseWriter){})
+
+	err := queueDriver.CreateQueueContext(context.Background(), "subscriptions")
+	if err == nil || !strings.Contains(err.Error(), "PGRST202") {
+		t.Fatal("Expected PostgREST error returned, got", err)
+	}
+}
+
+func TestSupabaseQueueDriver_AdminReadsResponses(t *testing.T) {
+	queueDriver, _ := newSupabaseStub(t, map[string]func(w http.ResponseWriter){
+		"drop_queue":  jsonResponse(`true`),
+		"purge_queue": jsonResponse(`3`),
+		"list_queues": jsonResponse(`[{"queue_name":"subscriptions","is_partitioned":false,"is_unlogged":true,"created_at":"2025-01-02T03:04:05.123456+00:00"}]`),
+		"metrics":     jsonResponse(`{"queue_name":"subscriptions","queue_length":2,"newest_msg_age_sec":1,"oldest_msg_age_sec":null,"total_messages":7,"scrape_time":"2025-01-02T03:04:05.123456+00:00"}`),
+	})
+	ctx := context.Background()
+
+	if dropped, err := queueDriver.DropQueue(ctx, "subscriptions"); err != nil || !dropped {
+		t.Fatal("Expected queue dropped, got", dropped, err)
+	}
+	if purged, err := queueDriver.PurgeQueue(ctx, "subscriptions"); err != nil || purged != 3 {
+		t.Fatal("Expected 3 messages purged, got", purged, err)
+	}
+
+	queues, err := queueDriver.ListQueues(ctx)
+	if err != nil || len(queues) != 1 || !queues[0].IsUnlogged || queues[0].CreatedAt.IsZero() {
+		t.Fatal("Expected 1 queue listed, got", queues, err)
+	}
+
+	metrics, err := queueDriver.Metrics(ctx, "subscriptions")
+	if err != nil || metrics.QueueLength != 2 || metrics.TotalMessages != 7 ||
+		metrics.NewestMsgAgeSec == nil || *metrics.NewestMsgAgeSec != 1 || metrics.OldestMsgAgeSec != nil {
+		t.Fatal("Expected metrics read, got", metrics, err)
+	}
+}
+
+func TestConsumer_EnsureQueuesWithSupabase(t *testing.T) {
+	queueDriver, calls := newSupabaseStub(t, map[string]func(w http.ResponseWriter){
+		"create": noContent,
+	})
+
+	c, err := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              30,
+		ConsumerType:                "read",
+		PoolSize:                    1,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 2,
+		EnsureQueues:                true,
+	}, queueDriver)
+	if err != nil {
+		t.Fatal("Expected consumer created, got", err)
+	}
+	if len(calls()) != 0 {
+		t.Fatal("Expected no rpc in NewConsumer, got", calls())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Run(ctx)
+	if len(calls()) < 2 || !strings.HasPrefix(calls()[0], `create {"queue_name":"subscriptions"}`) ||
+		!strings.HasPrefix(calls()[1], `create {"queue_name":"subscriptions_dlq"}`) {
+		t.Fatal("Expected queue and dlq created by Run, got", calls())
+	}
+}
+
+func TestSupabaseQueueDriver_DeletesEachMessageWithoutAckCoalescing(t *testing.T) {
+	queueDriver, calls := newSupabaseStub(t, map[string]func(w http.ResponseWriter){
+		"read": jsonResponse(`[
+			{"msg_id":1,"read_ct":1,"enqueued_at":"2024-01-01T00:00:00Z","vt":"2024-01-01T00:00:30Z","message":{"id":1}},
+			{"msg_id":2,"read_ct":1,"enqueued_at":"2024-01-01T00:00:00Z","vt":"2024-01-01T00:00:30Z","message":{"id":2}}
+		]`),
+		"delete": jsonResponse(`true`),
+	})
+
+	// pgmq_public has no delete receiving an array, a batch would be one rpc
+	// per message anyway.
+	if _, ok := interface{}(queueDriver).(consumer.BatchDeleter); ok {
+		t.Fatal("Expected Supabase driver without batch delete")
+	}
+
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 30,
+		ConsumerType:   "read",
+		PoolSize:       2,
+		EnabledPolling: false,
+	}, queueDriver)
+	c.Start()
+
+	deletes := 0
+	for _, call := range calls() {
+		if strings.HasPrefix(call, "delete ") {
+			deletes++
+		}
+	}
+	if deletes != 2 {
+		t.Fatal("Expected one delete rpc per message, got", calls())
+	}
+}
+
+func TestSupabaseQueueDriver_RetryPolicyIgnoredWithoutSetVt(t *testing.T) {
+	queueDriver, calls := newSupabaseStub(t, map[string]func(w http.ResponseWriter){
+		"read": jsonResponse(`[
+			{"msg_id":1,"read_ct":1,"enqueued_at":"2024-01-01T00:00:00Z","vt":"2024-01-01T00:00:30Z","message":{"id":1}},
+			{"msg_id":2,"read_ct":1,"enqueued_at":"2024-01-01T00:00:00Z","vt":"2024-01-01T00:00:30Z","message":{"id":2}}
+		]`),
+	})
+
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		return errors.New("smtp unavailable")
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 30,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		RetryPolicy:    consumer.FixedRetryPolicy(time.Second),
+		EventListeners: map[string]func(msg consumer.Message, err error){
+			consumer.EVENT_LISTENER_DRIVER_ERROR: func(msg consumer.Message, err error) {
+				t.Error("Expected no driver error without set_vt, got", err)
+			},
+		},
+	}, queueDriver)
+	c.Start()
+
+	setVts := 0
+	for _, call := range calls() {
+		if strings.HasPrefix(call, "set_vt ") {
+			setVts++
+		}
+	}
+	if setVts != 1 {
+		t.Fatal("Expected set_vt called once and then skipped, got", calls())
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer"
+	"github.com/tiago123456789/consumer-pgmq-go/consumer/tracing"
+	"github.com/tiago123456789/consumer-pgmq-go/fakeMock"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing_ShouldPropagateTraceContextFromProducerToConsumer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := tracing.NewTracer(tracing.TracerOptions{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	})
+
+	queueDriver := new(fakeMock.MockQueueDriver)
+	var sentHeaders map[string]interface{}
+	queueDriver.On("SendWithHeaders", "subscriptions", map[string]interface{}{"id": 1}, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			sentHeaders = args.Get(2).(map[string]interface{})
+		}).Return(nil)
+
+	err := tracer.Send(context.Background(), queueDriver, "subscriptions", map[string]interface{}{"id": 1}, map[string]interface{}{"tenant": "acme"})
+	if err != nil {
+		t.Fatal("Expected message sent", err)
+	}
+	if sentHeaders["traceparent"] == nil || sentHeaders["tenant"] != "acme" {
+		t.Fatal("Expected traceparent injected in headers, got", sentHeaders)
+	}
+
+	queueDriver.On("Get", "subscriptions", 10, 1).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, Message: map[string]interface{}{"id": 1}, Headers: sentHeaders},
+	}, nil)
+	queueDriver.On("Delete", "subscriptions", int64(1)).Return(nil)
+
+	var handlerSpan trace.SpanContext
+	c, _ := consumer.NewConsumerWithHandler(func(ctx context.Context, msg consumer.Message) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil
+	}, consumer.ConsumerOptions{
+		QueueName:      "subscriptions",
+		VisibilityTime: 10,
+		ConsumerType:   "read",
+		PoolSize:       1,
+		EnabledPolling: false,
+		Tracer:         tracer,
+	}, queueDriver)
+
+	c.Start()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatal("Expected producer and consumer spans, got", len(spans))
+	}
+	producer, consumerSpan := spans[0], spans[1]
+	if producer.SpanKind() != trace.SpanKindProducer || consumerSpan.SpanKind() != trace.SpanKindConsumer {
+		t.Fatal("Expected producer and consumer span kinds")
+	}
+	if consumerSpan.Parent().SpanID() != producer.SpanContext().SpanID() ||
+		consumerSpan.SpanContext().TraceID() != producer.SpanContext().TraceID() {
+		t.Fatal("Expected consumer span child of producer span")
+	}
+	if handlerSpan.SpanID() != consumerSpan.SpanContext().SpanID() {
+		t.Fatal("Expected handler ctx carrying the consumer span")
+	}
+}
+
+func TestTracing_ShouldRecordRetryAndDlqEvents(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := tracing.NewTracer(tracing.TracerOptions{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	})
+
+	queueDriver := new(fakeMock.MockQueueDriver)
+	queueDriver.On("Get", "subscriptions", 10, 2).Return([]consumer.Message{
+		{MsgID: 1, ReadCT: 1, Message: map[string]interface{}{"id": 1}},
+		{MsgID: 2, ReadCT: 3, Message: map[string]interface{}{"id": 2}},
+	}, nil)
+	queueDriver.On("SetVisibilityTime", "subscriptions", int64(1), 1).Return(nil)
+	queueDriver.On("Send", "subscriptions_dlq", map[string]interface{}{"id": 2}, context.Background()).Return(nil)
+	queueDriver.On("Delete", "subscriptions", int64(2)).Return(nil)
+
+	c, _ := consumer.NewConsumer(func(msg map[string]interface{}) error {
+		return errors.New("error processing message")
+	}, consumer.ConsumerOptions{
+		QueueName:                   "subscriptions",
+		VisibilityTime:              10,
+		ConsumerType:                "read",
+		PoolSize:                    2,
+		EnabledPolling:              false,
+		QueueNameDlq:                "subscriptions_dlq",
+		TotalRetriesBeforeSendToDlq: 2,
+		DlqRawBody:                  true,
+		RetryPolicy:                 consumer.FixedRetryPolicy(time.Second),
+		Tracer:                      tracer,
+	}, queueDriver)
+
+	c.Start()
+
+	events := map[string][]string{}
+	for _, span := range recorder.Ended() {
+		var msgID string
+		for _, attr := range span.Attributes() {
+			if attr.Key == "messaging.message.id" {
+				msgID = attr.Value.AsString()
+			}
+		}
+		for _, event := range span.Events() {
+			events[msgID] = append(events[msgID], event.Name)
+		}
+	}
+	if len(events["1"]) != 2 || events["1"][0] != "exception" || events["1"][1] != consumer.EVENT_LISTENER_RETRY {
+		t.Fatal("Expected exception and retry events, got", events["1"])
+	}
+	if len(events["2"]) != 1 || events["2"][0] != consumer.EVENT_LISTENER_SEND_TO_DLQ {
+		t.Fatal("Expected send-to-dlq event, got", events["2"])
+	}
+}